@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Role уровень доступа пользователя
+type Role int
+
+const (
+	RoleGuest Role = iota
+	RoleViewer
+	RoleEditor
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleAdmin:
+		return "admin"
+	case RoleEditor:
+		return "editor"
+	case RoleViewer:
+		return "viewer"
+	default:
+		return "guest"
+	}
+}
+
+// CanWrite сообщает, может ли роль изменять данные в Stash
+func (r Role) CanWrite() bool {
+	return r >= RoleEditor
+}
+
+type (
+	roleContextKey     struct{}
+	userContextKey     struct{}
+	personalContextKey struct{}
+)
+
+// RoleFromContext возвращает роль пользователя, определенную middleware доступа
+func RoleFromContext(ctx context.Context) Role {
+	role, ok := ctx.Value(roleContextKey{}).(Role)
+	if !ok {
+		return RoleGuest
+	}
+	return role
+}
+
+// UserIDFromContext возвращает идентификатор пользователя, от которого пришло обновление
+func UserIDFromContext(ctx context.Context) int64 {
+	userID, _ := ctx.Value(userContextKey{}).(int64)
+	return userID
+}
+
+// PersonalAccessFromContext сообщает, есть ли у пользователя доступ к боту сам по себе,
+// а не только через разрешенный чат. Так проверяются ссылки на стрим: в них нет чата.
+func PersonalAccessFromContext(ctx context.Context) bool {
+	personal, _ := ctx.Value(personalContextKey{}).(bool)
+	return personal
+}
+
+// AccessControl проверяет доступ пользователей к боту
+type AccessControl struct {
+	store  *ConfigStore
+	lists  atomic.Pointer[accessLists]
+	logger *Logger
+}
+
+// accessLists списки доступа, заменяемые целиком при перезагрузке конфигурации
+type accessLists struct {
+	admins  map[int64]bool
+	editors map[int64]bool
+	users   map[int64]bool
+	chats   map[int64]bool
+	open    bool
+}
+
+func NewAccessControl(store *ConfigStore) *AccessControl {
+	ac := &AccessControl{
+		store:  store,
+		logger: NewLogger("Access"),
+	}
+
+	ac.update(store.Get())
+	store.OnReload(ac.update)
+
+	return ac
+}
+
+// update перестраивает списки доступа по конфигурации
+func (ac *AccessControl) update(config *Config) {
+	lists := &accessLists{
+		admins:  toIDSet(config.AdminUserIDs),
+		editors: toIDSet(config.EditorUserIDs),
+		users:   toIDSet(config.AllowedUserIDs),
+		chats:   toIDSet(config.AllowedChatIDs),
+	}
+
+	// Без списков доступа бот закрыт для всех, если явно не включен ALLOW_ALL
+	empty := len(lists.admins) == 0 && len(lists.editors) == 0 && len(lists.users) == 0 && len(lists.chats) == 0
+	lists.open = empty && config.AllowAll
+	switch {
+	case lists.open:
+		ac.logger.Warning("Списки доступа не заданы, ALLOW_ALL включен - бот доступен всем пользователям")
+	case empty:
+		ac.logger.Warning("Списки доступа не заданы - бот никому не отвечает (задайте списки или ALLOW_ALL=true)")
+	}
+
+	ac.lists.Store(lists)
+}
+
+// RoleFor определяет роль пользователя в заданном чате
+func (ac *AccessControl) RoleFor(userID, chatID int64) Role {
+	lists := ac.lists.Load()
+
+	switch {
+	case lists.admins[userID]:
+		return RoleAdmin
+	case lists.editors[userID]:
+		return RoleEditor
+	case lists.users[userID], lists.chats[chatID], lists.open:
+		return RoleViewer
+	default:
+		return RoleGuest
+	}
+}
+
+// Middleware пропускает к обработчикам только разрешенных пользователей
+func (ac *AccessControl) Middleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		userID, chatID, ok := updateSource(update)
+		if !ok {
+			return
+		}
+
+		role := ac.RoleFor(userID, chatID)
+		if role == RoleGuest {
+			ac.logger.With("user_id", userID, "chat_id", chatID).Warning("Отклонен запрос без доступа")
+			ac.reject(ctx, b, update)
+			return
+		}
+
+		ctx = context.WithValue(ctx, roleContextKey{}, role)
+		ctx = context.WithValue(ctx, userContextKey{}, userID)
+		ctx = context.WithValue(ctx, personalContextKey{}, ac.RoleFor(userID, userID) != RoleGuest)
+		next(ctx, b, update)
+	}
+}
+
+// reject вежливо сообщает пользователю об отсутствии доступа
+func (ac *AccessControl) reject(ctx context.Context, b *bot.Bot, update *models.Update) {
+	text := ac.store.Get().Messages.AccessDenied
+
+	if update.CallbackQuery != nil {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			Text:            text,
+			ShowAlert:       true,
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+}
+
+// updateSource возвращает пользователя и чат, от которых пришло обновление
+func updateSource(update *models.Update) (int64, int64, bool) {
+	switch {
+	case update.Message != nil && update.Message.From != nil:
+		return update.Message.From.ID, update.Message.Chat.ID, true
+	case update.CallbackQuery != nil:
+		var chatID int64
+		if update.CallbackQuery.Message.Message != nil {
+			chatID = update.CallbackQuery.Message.Message.Chat.ID
+		}
+		return update.CallbackQuery.From.ID, chatID, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// parseIDList разбирает список идентификаторов, разделенных запятыми
+func parseIDList(value string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func toIDSet(ids []int64) map[int64]bool {
+	set := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func newTestAccessControl(config Config) *AccessControl {
+	return NewAccessControl(NewConfigStore(config))
+}
+
+func TestAccessControlRoleFor(t *testing.T) {
+	lists := Config{
+		AdminUserIDs:   []int64{1},
+		EditorUserIDs:  []int64{2},
+		AllowedUserIDs: []int64{3},
+		AllowedChatIDs: []int64{-100},
+	}
+	open := Config{AllowAll: true}
+	listsAndAllowAll := lists
+	listsAndAllowAll.AllowAll = true
+
+	tests := []struct {
+		name   string
+		config Config
+		userID int64
+		chatID int64
+		want   Role
+	}{
+		{"admin", lists, 1, 1, RoleAdmin},
+		{"admin in any chat", lists, 1, -200, RoleAdmin},
+		{"editor", lists, 2, 2, RoleEditor},
+		{"viewer", lists, 3, 3, RoleViewer},
+		{"member of allowed chat", lists, 4, -100, RoleViewer},
+		{"allowed chat only grants in that chat", lists, 4, 4, RoleGuest},
+		{"stranger", lists, 5, 5, RoleGuest},
+		{"no lists deny by default", Config{}, 5, 5, RoleGuest},
+		{"no lists with allow_all", open, 5, 5, RoleViewer},
+		{"allow_all ignored with lists", listsAndAllowAll, 5, 5, RoleGuest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac := newTestAccessControl(tt.config)
+			if got := ac.RoleFor(tt.userID, tt.chatID); got != tt.want {
+				t.Fatalf("RoleFor(%d, %d) = %s, want %s", tt.userID, tt.chatID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleCanWrite(t *testing.T) {
+	tests := []struct {
+		role Role
+		want bool
+	}{
+		{RoleGuest, false},
+		{RoleViewer, false},
+		{RoleEditor, true},
+		{RoleAdmin, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.CanWrite(); got != tt.want {
+			t.Errorf("%s.CanWrite() = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
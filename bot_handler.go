@@ -1,12 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"math/rand"
-	"path"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -15,18 +14,36 @@ import (
 // BotHandler структура для обработчиков бота
 type BotHandler struct {
 	stash       *StashClient
-	config      Config
+	config      *ConfigStore
 	fileManager *FileManager
+	previews    *PreviewCache
+	recent      *RecentScenes
+	uploader    *TelegramUploader
+	streams     *StreamSigner
 	logger      *Logger
+
+	// Поисковые запросы, не поместившиеся в callback данные кнопок страниц
+	searches *searchQueries
+
+	// Открытые редакторы тегов по сообщениям сцен
+	tagEditMu sync.Mutex
+	tagEdits  map[tagEditKey]*tagEditSession
 }
 
-func NewBotHandler(config Config) *BotHandler {
-	stashClient := NewStashClient(config.StashURL, config.StashAPIKey)
+func NewBotHandler(store *ConfigStore, streams *StreamSigner) *BotHandler {
+	config := store.Get()
+	stashClient := NewStashClient(*config)
 	return &BotHandler{
 		stash:       stashClient,
-		config:      config,
-		fileManager: NewFileManager(config.DATA),
+		config:      store,
+		fileManager: NewFileManager(config.DATA, config.StashAPIKey, int64(config.TelegramUploadLimitMB)*1024*1024, config.StashTimeout),
+		previews:    NewPreviewCache(config.DATA),
+		recent:      NewRecentScenes(),
+		uploader:    NewTelegramUploader(config),
+		streams:     streams,
 		logger:      NewLogger("BotHandler"),
+		searches:    newSearchQueries(),
+		tagEdits:    make(map[tagEditKey]*tagEditSession),
 	}
 }
 
@@ -42,26 +59,53 @@ func (h *BotHandler) HandleInfo(ctx context.Context, b *bot.Bot, update *models.
 
 // HandleRandom обработчик команды /random
 func (h *BotHandler) HandleRandom(ctx context.Context, b *bot.Bot, update *models.Update) {
-	h.logger.Info("Обработка команды /random от пользователя %d", update.Message.From.ID)
+	log := h.logger.With("user_id", update.Message.From.ID, "chat_id", update.Message.Chat.ID)
+	log.Info("Обработка команды /random")
 
 	b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
 		Text:   "🎲 Выбираю случайное видео...",
 	})
 
-	scene, err := h.stash.GetRandomScene()
+	scene, err := h.stash.GetRandomScene(ctx)
+	if h.replyOffline(ctx, b, update.Message.Chat.ID, err, nil) {
+		return
+	}
 	if err != nil {
-		h.logger.Error("Ошибка получения случайной сцены: %v", err)
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: update.Message.Chat.ID,
-			Text:   fmt.Sprintf("❌ Ошибка: %v", err),
-		})
+		log.Error("Ошибка получения случайной сцены: %v", err)
+		h.replyStashError(ctx, b, update.Message.Chat.ID, "❌ Ошибка: ", err)
 		return
 	}
 
 	h.sendScene(ctx, b, update.Message.Chat.ID, scene)
 }
 
+// parseCommand разбирает сообщение "/команда[@бот] аргументы" и возвращает имя
+// команды без "/" и упоминания бота и аргументы; false, если это не команда
+func parseCommand(text string) (string, string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+
+	command, args := text[1:], ""
+	if i := strings.IndexFunc(command, unicode.IsSpace); i >= 0 {
+		command, args = command[:i], strings.TrimSpace(command[i:])
+	}
+	command, _, _ = strings.Cut(command, "@")
+	return command, args, true
+}
+
+// matchCommand сопоставляет сообщения с командой name, в том числе с упоминанием бота
+func matchCommand(name string) bot.MatchFunc {
+	return func(update *models.Update) bool {
+		if update.Message == nil {
+			return false
+		}
+		command, _, ok := parseCommand(update.Message.Text)
+		return ok && command == name
+	}
+}
+
 // HandleMessage обработчик обычных сообщений
 func (h *BotHandler) HandleMessage(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if update.Message == nil || update.Message.Text == "" {
@@ -72,7 +116,13 @@ func (h *BotHandler) HandleMessage(ctx context.Context, b *bot.Bot, update *mode
 		return
 	}
 
-	h.sendHelp(ctx, b, update.Message.Chat.ID)
+	// Ожидается название тега для редактора тегов
+	if h.handleTagSearchQuery(ctx, b, update.Message) {
+		return
+	}
+
+	// Обычный текст считаем поисковым запросом
+	h.startSearch(ctx, b, update.Message.Chat.ID, strings.TrimSpace(update.Message.Text))
 }
 
 // HandleCallback обработчик callback запросов
@@ -83,211 +133,88 @@ func (h *BotHandler) HandleCallback(ctx context.Context, b *bot.Bot, update *mod
 
 	callback := update.CallbackQuery
 
+	if h.handleWriteCallback(ctx, b, callback) {
+		return
+	}
+
+	// Сообщение с кнопкой слишком старое или удалено: неизвестен даже чат,
+	// поэтому обработчики ниже могут считать callback.Message.Message доступным
+	msg := callback.Message.Message
+	if msg == nil {
+		h.answerCallback(ctx, b, callback, "❌ Сообщение недоступно, отправьте команду заново", true)
+		return
+	}
+
 	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
 		CallbackQueryID: callback.ID,
 	})
 
 	switch {
 	case callback.Data == "random":
-		scene, err := h.stash.GetRandomScene()
+		scene, err := h.stash.GetRandomScene(ctx)
+		if h.replyOffline(ctx, b, msg.Chat.ID, err, nil) {
+			return
+		}
 		if err != nil {
-			b.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID: callback.Message.Message.Chat.ID,
-				Text:   fmt.Sprintf("❌ Ошибка: %v", err),
-			})
+			h.replyStashError(ctx, b, msg.Chat.ID, "❌ Ошибка: ", err)
 			return
 		}
-		h.sendScene(ctx, b, callback.Message.Message.Chat.ID, scene)
+		h.sendScene(ctx, b, msg.Chat.ID, scene)
 
 	case strings.HasPrefix(callback.Data, "performer_"):
 		h.handlePerformerCallback(ctx, b, callback)
 	case strings.HasPrefix(callback.Data, "studio_"):
 		h.handleStudioCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "tag_"):
+		h.handleTagCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "tags_"):
+		h.handleSceneTagsCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "back_"):
+		h.handleSceneBackCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "markers_"):
+		h.handleSceneMarkersCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "marker_"):
+		h.handleMarkerCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "mtags_"):
+		h.handleMarkerTagsCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "mtag_"):
+		h.handleTagMarkersCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "browse_"):
+		h.handleBrowsePageCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "brandom_"):
+		h.handleBrowseRandomCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "search_"):
+		h.handleSearchPageCallback(ctx, b, callback)
+	case strings.HasPrefix(callback.Data, "scene_"):
+		h.handleSceneCallback(ctx, b, callback)
 	}
 }
 
-func (h *BotHandler) handleStudioCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
-	studioID := strings.TrimPrefix(callback.Data, "studio_")
-	h.logger.Info("Поиск видео студии: %s", studioID)
-
-	query := `
-		query FindScenes($studioID: [ID!]) {
-			findScenes(
-				scene_filter: {
-					studios: {
-						value: $studioID
-						modifier: INCLUDES
-					}
-				}
-			) {
-				scenes {
-					id
-					title
-					paths {
-						screenshot
-						stream
-						preview
-						sprite
-					}
-					performers {
-						id
-						name
-					}
-					studio {
-						id
-						name
-					}
-				}
-				count
-			}
-		}`
-
-	variables := map[string]interface{}{
-		"studioID": []string{studioID},
-	}
-
-	resp, err := h.stash.graphQLRequest(query, variables)
-	if err != nil {
-		h.logger.Error("Ошибка поиска: %v", err)
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: callback.Message.Message.Chat.ID,
-			Text:   fmt.Sprintf("❌ Ошибка поиска: %v", err),
-		})
-		return
-	}
-
-	if len(resp.Data.FindScenes.Scenes) == 0 {
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: callback.Message.Message.Chat.ID,
-			Text:   "❌ Видео с этим исполнителем не найдены",
-		})
-		return
-	}
-
-	randomIndex := rand.Intn(len(resp.Data.FindScenes.Scenes))
-	scene := &resp.Data.FindScenes.Scenes[randomIndex]
-
-	h.sendScene(ctx, b, callback.Message.Message.Chat.ID, scene)
-}
-
-// handlePerformerCallback обработка callback для исполнителя
-func (h *BotHandler) handlePerformerCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
-	performerID := strings.TrimPrefix(callback.Data, "performer_")
-	h.logger.Info("Поиск видео исполнителя: %s", performerID)
-
-	query := `
-		query FindScenes($performerID: [ID!]) {
-			findScenes(
-				scene_filter: {
-					performers: {
-						value: $performerID
-						modifier: INCLUDES
-					}
-				}
-			) {
-				scenes {
-					id
-					title
-					paths {
-						screenshot
-						stream
-						preview
-						sprite
-					}
-					performers {
-						id
-						name
-					}
-					studio {
-						id
-						name
-					}
-				}
-				count
-			}
-		}`
-
-	variables := map[string]interface{}{
-		"performerID": []string{performerID},
-	}
-
-	resp, err := h.stash.graphQLRequest(query, variables)
-	if err != nil {
-		h.logger.Error("Ошибка поиска: %v", err)
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: callback.Message.Message.Chat.ID,
-			Text:   fmt.Sprintf("❌ Ошибка поиска: %v", err),
-		})
-		return
-	}
-
-	if len(resp.Data.FindScenes.Scenes) == 0 {
-		b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: callback.Message.Message.Chat.ID,
-			Text:   "❌ Видео с этим исполнителем не найдены",
-		})
-		return
-	}
-
-	randomIndex := rand.Intn(len(resp.Data.FindScenes.Scenes))
-	scene := &resp.Data.FindScenes.Scenes[randomIndex]
-
-	h.sendScene(ctx, b, callback.Message.Message.Chat.ID, scene)
-}
-
 // sendScene отправляет сцену
 func (h *BotHandler) sendScene(ctx context.Context, b *bot.Bot, chatID int64, scene *Scene) {
-	h.logger.Info("Отправка сцены: %s", scene.Title)
-
-	previewURL := fmt.Sprintf("%s?apikey=%s", scene.Paths.Preview, h.config.StashAPIKey)
+	start := time.Now()
+	log := h.logger.With("user_id", UserIDFromContext(ctx), "chat_id", chatID, "scene_id", scene.ID)
+	log.Info("Отправка сцены: %s", scene.Title)
+	h.recent.Add(scene)
 
-	filepath, err := h.fileManager.DownloadFile(previewURL, scene.Title)
-	if err != nil {
-		h.logger.Error("Не удалось загрузить превью: %v", err)
-		h.sendSceneWithoutPreview(ctx, b, chatID, scene)
-		return
-	}
+	kb := h.sceneKeyboard(ctx, scene)
+	caption := formatSceneCaption(scene)
 
-	fileData, err := h.fileManager.ReadFile(filepath)
-	if err != nil {
-		h.logger.Error("Не удалось прочитать файл: %v", err)
+	if err := h.sendPreview(ctx, b, chatID, scenePreviewItem(scene), caption, kb); err != nil {
+		log.With(durationField(start)).Error("Не удалось отправить превью: %v", err)
 		h.sendSceneWithoutPreview(ctx, b, chatID, scene)
 		return
 	}
 
-	streamURL := fmt.Sprintf("%s", scene.Paths.Stream)
-	kb := CreateSceneKeyboard(scene, streamURL)
-	caption := fmt.Sprintf("🎬 <b>%s</b>", escapeHTML(scene.Title))
-
-	params := &bot.SendDocumentParams{
-		ChatID: chatID,
-		Document: &models.InputFileUpload{
-			Filename: path.Base(filepath),
-			Data:     bytes.NewReader(fileData),
-		},
-		Caption:     caption,
-		ParseMode:   models.ParseModeHTML,
-		ReplyMarkup: kb,
-	}
-
-	_, err = b.SendDocument(ctx, params)
-	if err != nil {
-		h.logger.Error("Не удалось отправить документ: %v", err)
-		h.sendSceneWithoutPreview(ctx, b, chatID, scene)
-	} else {
-		h.logger.Success("Сцена отправлена успешно")
-	}
-
-	h.fileManager.DeleteFile(filepath)
+	log.With(durationField(start)).Success("Сцена отправлена успешно")
 }
 
 // sendSceneWithoutPreview отправляет сцену без превью
 func (h *BotHandler) sendSceneWithoutPreview(ctx context.Context, b *bot.Bot, chatID int64, scene *Scene) {
 	h.logger.Warning("Отправка без превью")
 
-	streamURL := fmt.Sprintf("%s", scene.Paths.Stream)
-	kb := CreateSceneKeyboard(scene, streamURL)
-	text := fmt.Sprintf("🎬 <b>%s</b>", escapeHTML(scene.Title))
+	kb := h.sceneKeyboard(ctx, scene)
+	text := formatSceneCaption(scene)
 
 	b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:      chatID,
@@ -299,21 +226,11 @@ func (h *BotHandler) sendSceneWithoutPreview(ctx context.Context, b *bot.Bot, ch
 
 // sendHelp отправляет справку
 func (h *BotHandler) sendHelp(ctx context.Context, b *bot.Bot, chatID int64) {
-	helpText := `🎬 <b>StashApp Bot</b>
-
-<b>Доступные команды:</b>
-
-🎲 /random - Случайное видео
-ℹ️ /info - Информация о боте
-❓ /start - Начать работу
-
-💡 <i>Используйте /random для получения случайного видео</i>`
-
 	kb := CreateHelpKeyboard()
 
 	b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:      chatID,
-		Text:        helpText,
+		Text:        h.config.Get().Messages.Help,
 		ParseMode:   models.ParseModeHTML,
 		ReplyMarkup: kb,
 		LinkPreviewOptions: &models.LinkPreviewOptions{
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// browseFilter возвращает фильтр сцен для подборки заданного типа
+func browseFilter(kind, id string) (SceneFilter, bool) {
+	criterion := map[string]interface{}{
+		"value":    []string{id},
+		"modifier": "INCLUDES",
+	}
+
+	switch kind {
+	case "performer":
+		return SceneFilter{"performers": criterion}, true
+	case "studio":
+		return SceneFilter{"studios": criterion}, true
+	case "tag":
+		// depth -1 включает все дочерние теги
+		criterion["depth"] = -1
+		return SceneFilter{"tags": criterion}, true
+	default:
+		return nil, false
+	}
+}
+
+// browseTitle возвращает заголовок подборки
+func (h *BotHandler) browseTitle(ctx context.Context, kind, id string) string {
+	switch kind {
+	case "performer":
+		if performer, err := h.stash.FindPerformer(ctx, id); err == nil {
+			return "👤 " + performer.Name
+		}
+		return "👤 Исполнитель"
+	case "studio":
+		if studio, err := h.stash.FindStudio(ctx, id); err == nil {
+			return "📹 " + studio.Name
+		}
+		return "📹 Студия"
+	case "tag":
+		if tag, err := h.stash.FindTag(ctx, id); err == nil {
+			return "🏷 " + tag.Name
+		}
+		return "🏷 Тег"
+	default:
+		return "🎬 Подборка"
+	}
+}
+
+// handlePerformerCallback открывает список видео исполнителя
+func (h *BotHandler) handlePerformerCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	performerID := strings.TrimPrefix(callback.Data, "performer_")
+	h.logger.Info("Просмотр видео исполнителя: %s", performerID)
+	h.sendBrowsePage(ctx, b, callback.Message.Message.Chat.ID, 0, "performer", performerID, 1, "")
+}
+
+// handleStudioCallback открывает список видео студии
+func (h *BotHandler) handleStudioCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	studioID := strings.TrimPrefix(callback.Data, "studio_")
+	h.logger.Info("Просмотр видео студии: %s", studioID)
+	h.sendBrowsePage(ctx, b, callback.Message.Message.Chat.ID, 0, "studio", studioID, 1, "")
+}
+
+// handleTagCallback открывает список видео с тегом (включая дочерние теги)
+func (h *BotHandler) handleTagCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	tagID := strings.TrimPrefix(callback.Data, "tag_")
+	h.logger.Info("Просмотр видео с тегом: %s", tagID)
+	h.sendBrowsePage(ctx, b, callback.Message.Message.Chat.ID, 0, "tag", tagID, 1, "")
+}
+
+// handleSceneTagsCallback показывает все теги сцены вместо основной клавиатуры (tags_<id>[_<страница>])
+func (h *BotHandler) handleSceneTagsCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	sceneID, value, _ := strings.Cut(strings.TrimPrefix(callback.Data, "tags_"), "_")
+	page, err := strconv.Atoi(value)
+	if err != nil {
+		page = 1
+	}
+
+	h.editSceneKeyboard(ctx, b, callback, sceneID, func(scene *Scene) *models.InlineKeyboardMarkup {
+		return CreateTagsKeyboard(scene, page)
+	})
+}
+
+// handleSceneBackCallback возвращает основную клавиатуру сцены
+func (h *BotHandler) handleSceneBackCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	h.editSceneKeyboard(ctx, b, callback, strings.TrimPrefix(callback.Data, "back_"), func(scene *Scene) *models.InlineKeyboardMarkup {
+		return h.sceneKeyboard(ctx, scene)
+	})
+}
+
+// editSceneKeyboard заменяет клавиатуру сообщения сцены
+func (h *BotHandler) editSceneKeyboard(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery, sceneID string, build func(*Scene) *models.InlineKeyboardMarkup) {
+	msg := callback.Message.Message
+	if msg == nil {
+		return
+	}
+
+	scene, err := h.stash.FindScene(ctx, sceneID)
+	if err != nil {
+		h.logger.Error("Ошибка получения сцены %s: %v", sceneID, err)
+		h.replyStashError(ctx, b, msg.Chat.ID, "❌ Ошибка: ", err)
+		return
+	}
+
+	b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.ID,
+		ReplyMarkup: build(scene),
+	})
+}
+
+// handleBrowsePageCallback переключает страницу подборки (browse_<тип>_<id>_<страница>)
+func (h *BotHandler) handleBrowsePageCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	msg := callback.Message.Message
+	if msg == nil {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(callback.Data, "browse_"), "_")
+	if len(parts) != 3 {
+		return
+	}
+
+	page, err := strconv.Atoi(parts[2])
+	if err != nil || page < 1 {
+		return
+	}
+
+	h.sendBrowsePage(ctx, b, msg.Chat.ID, msg.ID, parts[0], parts[1], page, browsePageTitle(msg.Text))
+}
+
+// browsePageTitle извлекает заголовок подборки из первой строки открытой страницы
+// ("<заголовок>: N видео"), чтобы не запрашивать его у Stash при каждом листании
+func browsePageTitle(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	if i := strings.LastIndex(line, ": "); i > 0 {
+		return line[:i]
+	}
+	return ""
+}
+
+// handleBrowseRandomCallback отправляет случайную сцену из подборки (brandom_<тип>_<id>)
+func (h *BotHandler) handleBrowseRandomCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	chatID := callback.Message.Message.Chat.ID
+
+	kind, id, ok := strings.Cut(strings.TrimPrefix(callback.Data, "brandom_"), "_")
+	if !ok {
+		return
+	}
+
+	sceneFilter, ok := browseFilter(kind, id)
+	if !ok {
+		return
+	}
+
+	scene, err := h.stash.GetRandomSceneByFilter(ctx, sceneFilter)
+	if h.replyOffline(ctx, b, chatID, err, browseMatch(kind, id)) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Ошибка получения случайной сцены из подборки: %v", err)
+		h.replyStashError(ctx, b, chatID, "❌ Ошибка: ", err)
+		return
+	}
+
+	h.sendScene(ctx, b, chatID, scene)
+}
+
+// sendBrowsePage отправляет страницу подборки, а при messageID != 0 редактирует существующее сообщение.
+// Пустой title запрашивается у Stash.
+func (h *BotHandler) sendBrowsePage(ctx context.Context, b *bot.Bot, chatID int64, messageID int, kind, id string, page int, title string) {
+	perPage := h.config.Get().PerPage
+
+	sceneFilter, ok := browseFilter(kind, id)
+	if !ok {
+		return
+	}
+
+	result, err := h.stash.FindSceneList(ctx, FindFilter{
+		Page:      page,
+		PerPage:   perPage,
+		Sort:      "date",
+		Direction: "DESC",
+	}, sceneFilter)
+	if err != nil {
+		h.logger.Error("Ошибка поиска: %v", err)
+		h.replyStashError(ctx, b, chatID, "❌ Ошибка поиска: ", err)
+		return
+	}
+
+	if result.Count == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "❌ Видео не найдены",
+		})
+		return
+	}
+
+	totalPages := (result.Count + perPage - 1) / perPage
+
+	if title == "" {
+		title = h.browseTitle(ctx, kind, id)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<b>%s</b>: %d видео\n\n", escapeHTML(title), result.Count)
+	writeSceneList(&sb, result.Scenes, (page-1)*perPage)
+
+	kb := CreateBrowseKeyboard(kind, id, result.Scenes, page, totalPages)
+
+	if messageID != 0 {
+		b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      chatID,
+			MessageID:   messageID,
+			Text:        sb.String(),
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: kb,
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        sb.String(),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: kb,
+	})
+}
+
+// sceneListTitle предельная длина названия сцены в строке списка: сцены без
+// названия показываются путем к файлу, а PER_PAGE строк должны уместиться в 4096 символов
+const sceneListTitle = 30
+
+// writeSceneList выводит нумерованный список сцен с датой и длительностью
+func writeSceneList(sb *strings.Builder, scenes []Scene, offset int) {
+	for i := range scenes {
+		fmt.Fprintf(sb, "%d. %s", offset+i+1, escapeHTML(truncateUTF16(scenes[i].DisplayTitle(), sceneListTitle)))
+
+		var details []string
+		if scenes[i].Date != "" {
+			details = append(details, scenes[i].Date)
+		}
+		if duration := scenes[i].Duration(); duration > 0 {
+			details = append(details, formatDuration(duration))
+		}
+		if len(details) > 0 {
+			fmt.Fprintf(sb, " <i>(%s)</i>", strings.Join(details, ", "))
+		}
+
+		sb.WriteString("\n")
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestBrowsePageTitle(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"👤 Jane Doe: 42 видео\n\n1. Scene", "👤 Jane Doe"},
+		{"🏷 Tag: with colon: 3 видео\n\n1. Scene", "🏷 Tag: with colon"},
+		{"no header", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := browsePageTitle(tt.text); got != tt.want {
+			t.Errorf("browsePageTitle(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
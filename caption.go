@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// captionLimit максимальная длина подписи к медиа в Telegram
+const captionLimit = 1024
+
+const (
+	// captionMaxTags сколько тегов выводить в подписи
+	captionMaxTags = 15
+	// captionMaxTitle предельная длина названия в подписи (в единицах UTF-16)
+	captionMaxTitle = 200
+	// captionMaxTagsLength предельная длина строки тегов (в единицах UTF-16)
+	captionMaxTagsLength = 300
+)
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// formatSceneCaption формирует HTML подпись сцены с основной информацией
+func formatSceneCaption(scene *Scene) string {
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("🎬 <b>%s</b>", escapeHTML(truncateUTF16(scene.DisplayTitle(), captionMaxTitle))))
+
+	// Дата, длительность, рейтинг
+	var info []string
+	if scene.Date != "" {
+		info = append(info, "📅 "+scene.Date)
+	}
+	if duration := scene.Duration(); duration > 0 {
+		info = append(info, "⏱ "+formatDuration(duration))
+	}
+	if scene.Rating100 != nil {
+		info = append(info, ratingStars(*scene.Rating100))
+	}
+	if len(info) > 0 {
+		lines = append(lines, strings.Join(info, " · "))
+	}
+
+	// Счетчики
+	lines = append(lines, fmt.Sprintf("👁 %d · 💦 %d", scene.PlayCount, scene.OCounter))
+
+	// Информация о файле
+	if len(scene.Files) > 0 {
+		file := scene.Files[0]
+		var fileInfo []string
+		if file.Width > 0 && file.Height > 0 {
+			fileInfo = append(fileInfo, fmt.Sprintf("%d×%d", file.Width, file.Height))
+		}
+		if file.VideoCodec != "" {
+			fileInfo = append(fileInfo, file.VideoCodec)
+		}
+		if file.Size > 0 {
+			fileInfo = append(fileInfo, formatSize(file.Size))
+		}
+		if len(fileInfo) > 0 {
+			lines = append(lines, "📼 "+escapeHTML(strings.Join(fileInfo, " · ")))
+		}
+	}
+
+	// Теги
+	if len(scene.Tags) > 0 {
+		var tags []string
+		length := 0
+		for i, tag := range scene.Tags {
+			name := "#" + truncateUTF16(strings.Join(strings.Fields(tag.Name), "_"), captionMaxTitle)
+			// Оставляем место под "+N" с числом оставшихся тегов
+			if i == captionMaxTags || length+utf16Length(name)+1 > captionMaxTagsLength-5 {
+				tags = append(tags, fmt.Sprintf("+%d", len(scene.Tags)-i))
+				break
+			}
+			tags = append(tags, name)
+			length += utf16Length(name) + 1
+		}
+		lines = append(lines, "🏷 "+escapeHTML(strings.Join(tags, " ")))
+	}
+
+	caption := strings.Join(lines, "\n")
+
+	// Описание занимает оставшееся место
+	if details := strings.TrimSpace(scene.Details); details != "" {
+		budget := captionLimit - visibleLength(caption) - 2
+		if budget > 20 {
+			caption += "\n\n<i>" + escapeHTML(truncateUTF16(details, budget)) + "</i>"
+		}
+	}
+
+	return caption
+}
+
+// ratingStars отображает rating100 как пять звезд
+func ratingStars(rating100 int) string {
+	stars := ratingToStars(rating100)
+	return strings.Repeat("★", stars) + strings.Repeat("☆", 5-stars)
+}
+
+// ratingToStars переводит rating100 в количество звезд от 0 до 5
+func ratingToStars(rating100 int) int {
+	stars := (rating100 + 10) / 20
+	if stars > 5 {
+		return 5
+	}
+	if stars < 0 {
+		return 0
+	}
+	return stars
+}
+
+// visibleLength длина текста после разбора HTML в единицах UTF-16, как ее считает Telegram
+func visibleLength(text string) int {
+	plain := html.UnescapeString(htmlTagPattern.ReplaceAllString(text, ""))
+	return utf16Length(plain)
+}
+
+// utf16Length длина строки в единицах UTF-16
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// truncateUTF16 обрезает строку до maxLen единиц UTF-16 с многоточием.
+// В отличие от truncateString учитывает, что эмодзи вне BMP занимают две единицы.
+func truncateUTF16(s string, maxLen int) string {
+	if utf16Length(s) <= maxLen {
+		return s
+	}
+
+	n := 0
+	for i, r := range s {
+		n += utf16.RuneLen(r)
+		if n > maxLen-3 {
+			return s[:i] + "..."
+		}
+	}
+	return s
+}
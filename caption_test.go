@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncateUTF16(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"short", "abc", 5, "abc"},
+		{"exact", "abcde", 5, "abcde"},
+		{"ascii", "abcdefgh", 6, "abc..."},
+		{"cyrillic", "привет мир", 7, "прив..."},
+		{"astral emoji count twice", "😀😀😀😀", 5, "😀..."},
+		{"emoji not split", "a😀😀", 4, "a..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateUTF16(tt.in, tt.maxLen)
+			if got != tt.want {
+				t.Fatalf("truncateUTF16(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+			}
+			if utf16Length(got) > tt.maxLen {
+				t.Fatalf("truncateUTF16(%q, %d) length = %d", tt.in, tt.maxLen, utf16Length(got))
+			}
+		})
+	}
+}
+
+func TestFormatSceneCaptionLimit(t *testing.T) {
+	manyTags := make([]Tag, 40)
+	for i := range manyTags {
+		manyTags[i] = Tag{ID: "1", Name: strings.Repeat("&", 100)}
+	}
+
+	tests := []struct {
+		name  string
+		scene Scene
+	}{
+		{"long title", Scene{Title: strings.Repeat("<&>", 1000)}},
+		{"escaped tags", Scene{Title: "t", Tags: manyTags}},
+		{"astral details", Scene{Title: "t", Details: strings.Repeat("😀", 2000)}},
+		{"everything", Scene{Title: strings.Repeat("😀", 1000), Tags: manyTags, Details: strings.Repeat("😀", 2000)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caption := formatSceneCaption(&tt.scene)
+			if n := visibleLength(caption); n > captionLimit {
+				t.Fatalf("caption length = %d, limit %d", n, captionLimit)
+			}
+		})
+	}
+}
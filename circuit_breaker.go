@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrStashOffline возвращается без обращения к Stash, пока автомат разомкнут
+var ErrStashOffline = &StashError{Kind: StashErrOffline, Err: errors.New("запросы приостановлены до восстановления связи")}
+
+// breakerState состояние автомата
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker перестает отправлять запросы в Stash после нескольких отказов подряд,
+// чтобы пользователи не ждали таймаутов, пока Stash лежит. Связь проверяется
+// отдельно (см. StashClient.WatchAvailability), после чего запросы снова пропускаются.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *Logger
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker создает автомат; threshold 0 отключает его
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		logger:    NewLogger("Breaker"),
+	}
+}
+
+// Allow возвращает ErrStashOffline, если запросы сейчас не пропускаются
+func (cb *CircuitBreaker) Allow() error {
+	if cb.threshold <= 0 {
+		return nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != breakerClosed {
+		return ErrStashOffline
+	}
+	return nil
+}
+
+// Open сообщает, разомкнут ли автомат (Stash считается недоступным)
+func (cb *CircuitBreaker) Open() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state != breakerClosed
+}
+
+// Record учитывает результат запроса. Отказом считаются только сетевые ошибки
+// и ответы 5xx: ошибка GraphQL или авторизации означает, что Stash на связи.
+// Запрос, прерванный контекстом вызывающего, ничего не говорит о Stash и не учитывается.
+func (cb *CircuitBreaker) Record(err error) {
+	if cb.threshold <= 0 || callerAborted(err) || errors.Is(err, ErrStashOffline) {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !isOutage(err) {
+		if cb.state != breakerClosed {
+			cb.logger.Success("Stash снова доступен, запросы возобновлены")
+		}
+		cb.setState(breakerClosed)
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == breakerHalfOpen || (cb.state == breakerClosed && cb.failures >= cb.threshold) {
+		if cb.state == breakerClosed {
+			cb.logger.Warning("Stash недоступен после %d отказов подряд, запросы приостановлены: %v", cb.failures, err)
+		}
+		cb.setState(breakerOpen)
+		cb.openedAt = time.Now()
+	}
+}
+
+// tryProbe переводит разомкнутый автомат в полуоткрытое состояние, если пора
+// проверить связь; true означает, что проверку должен выполнить вызывающий
+func (cb *CircuitBreaker) tryProbe() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != breakerOpen || time.Since(cb.openedAt) < cb.cooldown {
+		return false
+	}
+	cb.setState(breakerHalfOpen)
+	return true
+}
+
+// setState меняет состояние и метрику; вызывается под cb.mu
+func (cb *CircuitBreaker) setState(state breakerState) {
+	cb.state = state
+	stashCircuitState.Set(float64(state))
+}
+
+// callerAborted сообщает, что запрос прерван контекстом вызывающего. Таймаут
+// HTTP клиента приходит как StashError и считается отказом Stash.
+func callerAborted(err error) bool {
+	var stashErr *StashError
+	if errors.As(err, &stashErr) {
+		return false
+	}
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// isOutage сообщает, говорит ли ошибка о недоступности Stash
+func isOutage(err error) bool {
+	var stashErr *StashError
+	if !errors.As(err, &stashErr) {
+		return false
+	}
+	return stashErr.Kind == StashErrNetwork || stashErr.Kind == StashErrServer
+}
@@ -1,46 +1,534 @@
 package main
 
 import (
-	"log"
+	"bytes"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
-// Config структура для конфигурации
+// PreviewMode способ отправки превью в Telegram
+type PreviewMode string
+
+const (
+	PreviewModeDocument  PreviewMode = "document"
+	PreviewModeVideo     PreviewMode = "video"
+	PreviewModeAnimation PreviewMode = "animation"
+)
+
+// UpdateMode способ получения обновлений от Telegram
+type UpdateMode string
+
+const (
+	UpdateModePolling UpdateMode = "polling"
+	UpdateModeWebhook UpdateMode = "webhook"
+)
+
+// Config структура для конфигурации.
+// Значения берутся из файла конфигурации (CONFIG_FILE), переменные окружения имеют приоритет.
 type Config struct {
-	TelegramToken string
-	StashURL      string
-	StashAPIKey   string
-	DATA          string
+	TelegramToken string      `yaml:"telegram_token"`
+	StashURL      string      `yaml:"stash_url"`
+	StashAPIKey   string      `yaml:"stash_api_key"`
+	DATA          string      `yaml:"data"`
+	PreviewMode   PreviewMode `yaml:"preview_mode"`
+
+	// Адрес Bot API (свой сервер telegram-bot-api вместо api.telegram.org)
+	// и предельное время загрузки одного превью в Telegram
+	TelegramAPIURL        string        `yaml:"telegram_api_url"`
+	TelegramUploadTimeout time.Duration `yaml:"telegram_upload_timeout"`
+	// TelegramUploadLimitMB максимальный размер превью: api.telegram.org принимает
+	// до 50 МБ, собственный сервер в режиме --local - до 2000 МБ
+	TelegramUploadLimitMB int `yaml:"telegram_upload_limit_mb"`
+
+	// Запросы к Stash: таймаут, число попыток и пауза перед повтором
+	// (удваивается с каждой попыткой, но не больше StashRetryMaxDelay)
+	StashTimeout       time.Duration `yaml:"stash_timeout"`
+	StashRetries       int           `yaml:"stash_retries"`
+	StashRetryDelay    time.Duration `yaml:"stash_retry_delay"`
+	StashRetryMaxDelay time.Duration `yaml:"stash_retry_max_delay"`
+
+	// После StashBreakerThreshold неудачных запросов подряд запросы к Stash
+	// приостанавливаются; связь проверяется каждые StashBreakerCooldown.
+	// 0 отключает приостановку.
+	StashBreakerThreshold int           `yaml:"stash_breaker_threshold"`
+	StashBreakerCooldown  time.Duration `yaml:"stash_breaker_cooldown"`
+
+	// Количество элементов на странице списков
+	PerPage int `yaml:"per_page"`
+
+	// Адрес Stash для ссылок в сообщениях (если бот ходит в Stash по внутреннему адресу)
+	StashPublicURL string `yaml:"stash_public_url"`
+	// Показывать ли кнопку стрима
+	StreamButton bool `yaml:"stream_button"`
+	// Адрес встроенного сервера стрима и внешний адрес, по которому он доступен
+	StreamListen    string `yaml:"stream_listen"`
+	StreamPublicURL string `yaml:"stream_public_url"`
+	// Секрет для подписи ссылок на стрим и срок их действия
+	StreamSecret  string        `yaml:"stream_secret"`
+	StreamLinkTTL time.Duration `yaml:"stream_link_ttl"`
+
+	// Получение обновлений: long polling или вебхук
+	UpdateMode      UpdateMode `yaml:"update_mode"`
+	WebhookListen   string     `yaml:"webhook_listen"`
+	WebhookURL      string     `yaml:"webhook_url"`
+	WebhookSecret   string     `yaml:"webhook_secret"`
+	WebhookCertFile string     `yaml:"webhook_cert"`
+	WebhookKeyFile  string     `yaml:"webhook_key"`
+	// WebhookSelfSigned передавать сертификат Telegram при регистрации вебхука:
+	// нужно только для самоподписанного сертификата
+	WebhookSelfSigned bool `yaml:"webhook_self_signed"`
+
+	// Списки доступа (идентификаторы Telegram)
+	AdminUserIDs   []int64 `yaml:"admin_users"`
+	EditorUserIDs  []int64 `yaml:"editor_users"`
+	AllowedUserIDs []int64 `yaml:"allowed_users"`
+	AllowedChatIDs []int64 `yaml:"allowed_chats"`
+	// AllowAll открывает бот всем пользователям Telegram, если списки доступа не заданы
+	AllowAll bool `yaml:"allow_all"`
+
+	// Ограничение частоты запросов в минуту для пользователей каждой роли и для
+	// групповых чатов; RateLimitBurst - сколько запросов можно сделать подряд.
+	// 0 снимает ограничение.
+	RateLimitViewer int `yaml:"rate_limit_viewer"`
+	RateLimitEditor int `yaml:"rate_limit_editor"`
+	RateLimitAdmin  int `yaml:"rate_limit_admin"`
+	RateLimitChat   int `yaml:"rate_limit_chat"`
+	RateLimitBurst  int `yaml:"rate_limit_burst"`
+
+	// Адрес сервера метрик Prometheus (/metrics) и проверки состояния (/healthz)
+	MetricsListen string `yaml:"metrics_listen"`
+
+	// Логи: формат (console или json) и уровень (debug, info, warn, error)
+	LogFormat LogFormat `yaml:"log_format"`
+	LogLevel  string    `yaml:"log_level"`
+
+	// Тексты сообщений бота
+	Messages Messages `yaml:"messages"`
+
+	// Секрет вебхука сгенерирован, а не задан в конфигурации
+	webhookSecretGenerated bool
+}
+
+// Messages настраиваемые тексты сообщений (HTML разметка Telegram)
+type Messages struct {
+	Help         string `yaml:"help"`
+	AccessDenied string `yaml:"access_denied"`
+	NoWriteRight string `yaml:"no_write_right"`
+	StashOffline string `yaml:"stash_offline"`
+	SlowDown     string `yaml:"slow_down"`
 }
 
-// LoadConfig загружает конфигурацию из переменных окружения
-func LoadConfig() Config {
+// defaultHelpMessage текст справки по умолчанию
+const defaultHelpMessage = `🎬 <b>StashApp Bot</b>
+
+<b>Доступные команды:</b>
+
+🎲 /random - Случайное видео
+🔍 /search - Поиск видео по названию
+📍 /markers - Маркеры по тегам
+ℹ️ /info - Информация о боте
+❓ /start - Начать работу
+
+💡 <i>Используйте /random для получения случайного видео или просто отправьте текст для поиска</i>`
+
+// defaultConfig значения по умолчанию
+func defaultConfig() Config {
+	return Config{
+		// DATA нужна только для превью неизвестного размера и кэша file_id
+		DATA:        filepath.Join(os.TempDir(), "stash-telegram-bot"),
+		PreviewMode: PreviewModeDocument,
+
+		TelegramAPIURL:        "https://api.telegram.org",
+		TelegramUploadTimeout: 5 * time.Minute,
+		TelegramUploadLimitMB: 50,
+
+		StashTimeout:       60 * time.Second,
+		StashRetries:       3,
+		StashRetryDelay:    2 * time.Second,
+		StashRetryMaxDelay: 30 * time.Second,
+
+		StashBreakerThreshold: 3,
+		StashBreakerCooldown:  30 * time.Second,
+
+		PerPage: 10,
+
+		StreamButton:  true,
+		StreamLinkTTL: 6 * time.Hour,
+
+		UpdateMode:    UpdateModePolling,
+		WebhookListen: ":8443",
+
+		RateLimitViewer: 20,
+		RateLimitEditor: 40,
+		RateLimitChat:   60,
+		RateLimitBurst:  5,
+
+		LogFormat: LogFormatConsole,
+		LogLevel:  "info",
 
-	config := Config{
-		TelegramToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
-		StashURL:      os.Getenv("STASH_URL"),
-		StashAPIKey:   os.Getenv("STASH_API_KEY"),
-		DATA:          os.Getenv("DATA"),
+		Messages: Messages{
+			Help:         defaultHelpMessage,
+			AccessDenied: "⛔ У вас нет доступа к этому боту. Обратитесь к администратору.",
+			NoWriteRight: "⛔ У вас нет прав на изменение",
+			StashOffline: "📴 Библиотека Stash сейчас недоступна, попробуйте позже",
+			SlowDown:     "🐢 Не так быстро! Подождите немного",
+		},
 	}
+}
+
+// LoadConfig загружает конфигурацию: значения по умолчанию, затем файл CONFIG_FILE,
+// затем переменные окружения. Все ошибки возвращаются вместе.
+func LoadConfig() (Config, error) {
+	config := defaultConfig()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadConfigFile(path, &config); err != nil {
+			return config, err
+		}
+	}
+
+	env := &envLoader{}
+	env.String("TELEGRAM_BOT_TOKEN", &config.TelegramToken)
+	env.String("STASH_URL", &config.StashURL)
+	env.String("STASH_API_KEY", &config.StashAPIKey)
+	env.String("DATA", &config.DATA)
+	env.String("PREVIEW_MODE", (*string)(&config.PreviewMode))
+	env.String("TELEGRAM_API_URL", &config.TelegramAPIURL)
+	env.Duration("TELEGRAM_UPLOAD_TIMEOUT", &config.TelegramUploadTimeout)
+	env.Int("TELEGRAM_UPLOAD_LIMIT_MB", &config.TelegramUploadLimitMB)
+
+	env.Duration("STASH_TIMEOUT", &config.StashTimeout)
+	env.Int("STASH_RETRIES", &config.StashRetries)
+	env.Duration("STASH_RETRY_DELAY", &config.StashRetryDelay)
+	env.Duration("STASH_RETRY_MAX_DELAY", &config.StashRetryMaxDelay)
+	env.Int("STASH_BREAKER_THRESHOLD", &config.StashBreakerThreshold)
+	env.Duration("STASH_BREAKER_COOLDOWN", &config.StashBreakerCooldown)
+	env.Int("PER_PAGE", &config.PerPage)
+
+	env.String("STASH_PUBLIC_URL", &config.StashPublicURL)
+	env.Bool("STREAM_BUTTON", &config.StreamButton)
+	env.String("STREAM_LISTEN", &config.StreamListen)
+	env.String("STREAM_PUBLIC_URL", &config.StreamPublicURL)
+	env.String("STREAM_SECRET", &config.StreamSecret)
+	env.Duration("STREAM_LINK_TTL", &config.StreamLinkTTL)
+
+	env.String("UPDATE_MODE", (*string)(&config.UpdateMode))
+	env.String("WEBHOOK_LISTEN", &config.WebhookListen)
+	env.String("WEBHOOK_URL", &config.WebhookURL)
+	env.String("WEBHOOK_SECRET", &config.WebhookSecret)
+	env.String("WEBHOOK_CERT", &config.WebhookCertFile)
+	env.String("WEBHOOK_KEY", &config.WebhookKeyFile)
+	env.Bool("WEBHOOK_SELF_SIGNED", &config.WebhookSelfSigned)
+
+	env.Int("RATE_LIMIT_VIEWER", &config.RateLimitViewer)
+	env.Int("RATE_LIMIT_EDITOR", &config.RateLimitEditor)
+	env.Int("RATE_LIMIT_ADMIN", &config.RateLimitAdmin)
+	env.Int("RATE_LIMIT_CHAT", &config.RateLimitChat)
+	env.Int("RATE_LIMIT_BURST", &config.RateLimitBurst)
+
+	env.String("METRICS_LISTEN", &config.MetricsListen)
+
+	env.String("LOG_FORMAT", (*string)(&config.LogFormat))
+	env.String("LOG_LEVEL", &config.LogLevel)
+
+	env.IDs("ADMIN_USERS", &config.AdminUserIDs)
+	env.IDs("EDITOR_USERS", &config.EditorUserIDs)
+	env.IDs("ALLOWED_USERS", &config.AllowedUserIDs)
+	env.IDs("ALLOWED_CHATS", &config.AllowedChatIDs)
+	env.Bool("ALLOW_ALL", &config.AllowAll)
+
+	config.normalize()
+
+	if errs := append(env.errs, config.validate()...); len(errs) > 0 {
+		return config, ConfigErrors(errs)
+	}
+
+	return config, nil
+}
+
+// loadConfigFile читает YAML файл конфигурации поверх значений по умолчанию
+func loadConfigFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать файл конфигурации: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("ошибка в файле конфигурации %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// normalize приводит адреса к единому виду и заполняет производные значения
+func (c *Config) normalize() {
+	c.StashURL = strings.TrimSuffix(c.StashURL, "/")
+	c.TelegramAPIURL = strings.TrimSuffix(c.TelegramAPIURL, "/")
 
-	if config.TelegramToken == "" {
-		log.Fatal("TELEGRAM_BOT_TOKEN не установлен")
+	if c.StashPublicURL == "" {
+		c.StashPublicURL = c.StashURL
 	}
+	c.StashPublicURL = strings.TrimSuffix(c.StashPublicURL, "/")
+	c.StreamPublicURL = strings.TrimSuffix(c.StreamPublicURL, "/")
 
-	if config.StashURL == "" {
-		log.Fatal("STASH_URL не установлен")
+	// Без заданного секрета генерируем случайный: вебхук регистрируется заново при каждом запуске
+	if c.UpdateMode == UpdateModeWebhook && c.WebhookSecret == "" {
+		c.WebhookSecret = randomToken()
+		c.webhookSecretGenerated = true
+	}
+}
+
+// validate проверяет конфигурацию и возвращает все найденные ошибки
+func (c *Config) validate() []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
 	}
 
-	if config.StashAPIKey == "" {
-		log.Fatal("STASH_API_KEY не установлен")
+	if c.TelegramToken == "" {
+		fail("TELEGRAM_BOT_TOKEN не установлен")
+	}
+	if !validHTTPURL(c.TelegramAPIURL) {
+		fail("TELEGRAM_API_URL должен быть адресом http(s), получено: %s", c.TelegramAPIURL)
+	}
+	if c.TelegramUploadTimeout <= 0 {
+		fail("TELEGRAM_UPLOAD_TIMEOUT должен быть положительной длительностью, получено: %s", c.TelegramUploadTimeout)
+	}
+	if c.TelegramUploadLimitMB < 1 || c.TelegramUploadLimitMB > 2000 {
+		fail("TELEGRAM_UPLOAD_LIMIT_MB должен быть от 1 до 2000, получено: %d", c.TelegramUploadLimitMB)
 	}
 
-	if config.DATA == "" {
-		log.Fatal("DATA не установлен")
+	if c.StashURL == "" {
+		fail("STASH_URL не установлен")
+	} else if !validHTTPURL(c.StashURL) {
+		fail("STASH_URL должен быть адресом http(s), получено: %s", c.StashURL)
 	}
 
-	config.StashURL = strings.TrimSuffix(config.StashURL, "/")
+	if c.StashPublicURL != c.StashURL && !validHTTPURL(c.StashPublicURL) {
+		fail("STASH_PUBLIC_URL должен быть адресом http(s), получено: %s", c.StashPublicURL)
+	}
 
-	return config
+	switch c.PreviewMode {
+	case PreviewModeDocument, PreviewModeVideo, PreviewModeAnimation:
+	default:
+		fail("PREVIEW_MODE должен быть document, video или animation, получено: %s", c.PreviewMode)
+	}
+
+	if c.StashTimeout <= 0 {
+		fail("STASH_TIMEOUT должен быть положительной длительностью, получено: %s", c.StashTimeout)
+	}
+	if c.StashRetries < 1 {
+		fail("STASH_RETRIES должен быть не меньше 1, получено: %d", c.StashRetries)
+	}
+	if c.StashRetryDelay < 0 {
+		fail("STASH_RETRY_DELAY не может быть отрицательным, получено: %s", c.StashRetryDelay)
+	}
+	if c.StashRetryMaxDelay < c.StashRetryDelay {
+		fail("STASH_RETRY_MAX_DELAY не может быть меньше STASH_RETRY_DELAY, получено: %s", c.StashRetryMaxDelay)
+	}
+	if c.StashBreakerThreshold < 0 {
+		fail("STASH_BREAKER_THRESHOLD не может быть отрицательным, получено: %d", c.StashBreakerThreshold)
+	}
+	if c.StashBreakerThreshold > 0 && c.StashBreakerCooldown <= 0 {
+		fail("STASH_BREAKER_COOLDOWN должен быть положительной длительностью, получено: %s", c.StashBreakerCooldown)
+	}
+	if c.PerPage < 1 || c.PerPage > 50 {
+		fail("PER_PAGE должен быть от 1 до 50, получено: %d", c.PerPage)
+	}
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"RATE_LIMIT_VIEWER", c.RateLimitViewer},
+		{"RATE_LIMIT_EDITOR", c.RateLimitEditor},
+		{"RATE_LIMIT_ADMIN", c.RateLimitAdmin},
+		{"RATE_LIMIT_CHAT", c.RateLimitChat},
+	} {
+		if limit.value < 0 {
+			fail("%s не может быть отрицательным, получено: %d", limit.name, limit.value)
+		}
+	}
+	if c.RateLimitBurst < 1 {
+		fail("RATE_LIMIT_BURST должен быть не меньше 1, получено: %d", c.RateLimitBurst)
+	}
+
+	if c.StreamPublicURL != "" && !validHTTPURL(c.StreamPublicURL) {
+		fail("STREAM_PUBLIC_URL должен быть адресом http(s), получено: %s", c.StreamPublicURL)
+	}
+	if c.StreamLinkTTL <= 0 {
+		fail("STREAM_LINK_TTL должен быть положительной длительностью (например 6h), получено: %s", c.StreamLinkTTL)
+	}
+
+	switch c.LogFormat {
+	case LogFormatConsole, LogFormatJSON:
+	default:
+		fail("LOG_FORMAT должен быть console или json, получено: %s", c.LogFormat)
+	}
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		fail("LOG_LEVEL должен быть debug, info, warn или error, получено: %s", c.LogLevel)
+	}
+
+	if strings.TrimSpace(c.Messages.Help) == "" {
+		fail("messages.help не может быть пустым")
+	}
+	if strings.TrimSpace(c.Messages.AccessDenied) == "" {
+		fail("messages.access_denied не может быть пустым")
+	}
+	if strings.TrimSpace(c.Messages.NoWriteRight) == "" {
+		fail("messages.no_write_right не может быть пустым")
+	}
+	if strings.TrimSpace(c.Messages.StashOffline) == "" {
+		fail("messages.stash_offline не может быть пустым")
+	}
+	if strings.TrimSpace(c.Messages.SlowDown) == "" {
+		fail("messages.slow_down не может быть пустым")
+	}
+
+	switch c.UpdateMode {
+	case UpdateModePolling:
+	case UpdateModeWebhook:
+		if c.WebhookURL == "" {
+			fail("WEBHOOK_URL не установлен")
+		} else if !validHTTPURL(c.WebhookURL) {
+			fail("WEBHOOK_URL должен быть адресом http(s), получено: %s", c.WebhookURL)
+		}
+		if c.WebhookListen == "" {
+			fail("WEBHOOK_LISTEN не установлен")
+		}
+		if (c.WebhookCertFile == "") != (c.WebhookKeyFile == "") {
+			fail("WEBHOOK_CERT и WEBHOOK_KEY должны быть заданы вместе")
+		}
+		if c.WebhookSelfSigned && c.WebhookCertFile == "" {
+			fail("WEBHOOK_SELF_SIGNED требует WEBHOOK_CERT")
+		}
+		if !validWebhookSecret(c.WebhookSecret) {
+			fail("WEBHOOK_SECRET может содержать только A-Z, a-z, 0-9, _ и - (до 256 символов)")
+		}
+	default:
+		fail("UPDATE_MODE должен быть polling или webhook, получено: %s", c.UpdateMode)
+	}
+
+	return errs
+}
+
+// ConfigErrors все ошибки проверки конфигурации
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = "  - " + err.Error()
+	}
+	return fmt.Sprintf("конфигурация содержит ошибки (%d):\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+func (e ConfigErrors) Unwrap() []error {
+	return e
+}
+
+// envLoader переносит переменные окружения в конфигурацию, накапливая ошибки разбора.
+// Пустые переменные не переопределяют значения из файла.
+type envLoader struct {
+	errs []error
+}
+
+func (e *envLoader) String(name string, target *string) {
+	if value := os.Getenv(name); value != "" {
+		*target = value
+	}
+}
+
+func (e *envLoader) Int(name string, target *int) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s должен быть числом, получено: %s", name, value))
+		return
+	}
+	*target = n
+}
+
+func (e *envLoader) Bool(name string, target *bool) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s должен быть true или false, получено: %s", name, value))
+		return
+	}
+	*target = b
+}
+
+func (e *envLoader) Duration(name string, target *time.Duration) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s должен быть длительностью (например 30s), получено: %s", name, value))
+		return
+	}
+	*target = d
+}
+
+func (e *envLoader) IDs(name string, target *[]int64) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	ids, err := parseIDList(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s содержит неверный идентификатор: %v", name, err))
+		return
+	}
+	*target = ids
+}
+
+// validHTTPURL проверяет, что строка - абсолютный адрес http или https
+func validHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// randomToken создает случайный секрет для вебхука
+func randomToken() string {
+	buf := make([]byte, 32)
+	crand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// validWebhookSecret проверяет секрет вебхука по правилам Telegram
+func validWebhookSecret(secret string) bool {
+	if secret == "" || len(secret) > 256 {
+		return false
+	}
+	for _, r := range secret {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
 }
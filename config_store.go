@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// configWatchInterval как часто проверяется изменение файла конфигурации
+const configWatchInterval = 5 * time.Second
+
+// ConfigStore хранит текущую конфигурацию и заменяет ее целиком при перезагрузке,
+// так что обработчик, взявший снимок через Get, видит согласованные значения
+type ConfigStore struct {
+	current atomic.Pointer[Config]
+	path    string
+	logger  *Logger
+
+	mu        sync.Mutex
+	listeners []func(*Config)
+}
+
+func NewConfigStore(config Config) *ConfigStore {
+	store := &ConfigStore{
+		path:   os.Getenv("CONFIG_FILE"),
+		logger: NewLogger("Config"),
+	}
+	store.current.Store(&config)
+	return store
+}
+
+// Get возвращает снимок текущей конфигурации. Снимок нельзя изменять.
+func (s *ConfigStore) Get() *Config {
+	return s.current.Load()
+}
+
+// OnReload регистрирует функцию, вызываемую после успешной перезагрузки
+func (s *ConfigStore) OnReload(listener func(*Config)) {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
+}
+
+// Reload перечитывает конфигурацию. При ошибке остается прежняя конфигурация.
+func (s *ConfigStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	current := s.Get()
+	for _, name := range next.keepStatic(current) {
+		s.logger.Warning("%s изменен, но применится только после перезапуска", name)
+	}
+
+	s.current.Store(&next)
+	for _, listener := range s.listeners {
+		listener(&next)
+	}
+
+	s.logger.Success("Конфигурация перезагружена")
+	return nil
+}
+
+// Watch перезагружает конфигурацию по SIGHUP и при изменении файла конфигурации
+func (s *ConfigStore) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	modTime := s.fileModTime()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			s.logger.Info("Получен SIGHUP, перезагрузка конфигурации")
+			modTime = s.fileModTime()
+		case <-ticker.C:
+			changed := s.fileModTime()
+			if changed.Equal(modTime) {
+				continue
+			}
+			modTime = changed
+			s.logger.Info("Файл конфигурации изменен, перезагрузка")
+		}
+
+		if err := s.Reload(); err != nil {
+			s.logger.Error("Конфигурация не перезагружена: %v", err)
+		}
+	}
+}
+
+// fileModTime возвращает время изменения файла конфигурации
+func (s *ConfigStore) fileModTime() time.Time {
+	if s.path == "" {
+		return time.Time{}
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// keepStatic возвращает в конфигурацию значения, которые используются только при запуске
+// (подключения, серверы, секреты), и перечисляет те из них, что изменились
+func (c *Config) keepStatic(old *Config) []string {
+	var changed []string
+	keep := func(name string, value *string, previous string) {
+		if *value != previous {
+			changed = append(changed, name)
+			*value = previous
+		}
+	}
+
+	keep("TELEGRAM_BOT_TOKEN", &c.TelegramToken, old.TelegramToken)
+	keep("TELEGRAM_API_URL", &c.TelegramAPIURL, old.TelegramAPIURL)
+	keep("STASH_URL", &c.StashURL, old.StashURL)
+	keep("STASH_API_KEY", &c.StashAPIKey, old.StashAPIKey)
+	keep("DATA", &c.DATA, old.DATA)
+	keep("STREAM_LISTEN", &c.StreamListen, old.StreamListen)
+	keep("STREAM_PUBLIC_URL", &c.StreamPublicURL, old.StreamPublicURL)
+	keep("STREAM_SECRET", &c.StreamSecret, old.StreamSecret)
+	keep("UPDATE_MODE", (*string)(&c.UpdateMode), string(old.UpdateMode))
+	keep("WEBHOOK_LISTEN", &c.WebhookListen, old.WebhookListen)
+	keep("WEBHOOK_URL", &c.WebhookURL, old.WebhookURL)
+	keep("WEBHOOK_CERT", &c.WebhookCertFile, old.WebhookCertFile)
+	keep("WEBHOOK_KEY", &c.WebhookKeyFile, old.WebhookKeyFile)
+	if c.WebhookSelfSigned != old.WebhookSelfSigned {
+		changed = append(changed, "WEBHOOK_SELF_SIGNED")
+		c.WebhookSelfSigned = old.WebhookSelfSigned
+	}
+	keep("METRICS_LISTEN", &c.MetricsListen, old.MetricsListen)
+	keep("LOG_FORMAT", (*string)(&c.LogFormat), string(old.LogFormat))
+
+	// Случайный секрет вебхука генерируется заново при каждой загрузке - это не изменение
+	if c.webhookSecretGenerated && old.webhookSecretGenerated {
+		c.WebhookSecret = old.WebhookSecret
+	}
+	keep("WEBHOOK_SECRET", &c.WebhookSecret, old.WebhookSecret)
+	c.webhookSecretGenerated = old.webhookSecretGenerated
+
+	if c.StashTimeout != old.StashTimeout || c.StashRetries != old.StashRetries ||
+		c.StashRetryDelay != old.StashRetryDelay || c.StashRetryMaxDelay != old.StashRetryMaxDelay {
+		changed = append(changed, "STASH_TIMEOUT/STASH_RETRIES/STASH_RETRY_DELAY/STASH_RETRY_MAX_DELAY")
+		c.StashTimeout, c.StashRetries = old.StashTimeout, old.StashRetries
+		c.StashRetryDelay, c.StashRetryMaxDelay = old.StashRetryDelay, old.StashRetryMaxDelay
+	}
+	if c.StashBreakerThreshold != old.StashBreakerThreshold || c.StashBreakerCooldown != old.StashBreakerCooldown {
+		changed = append(changed, "STASH_BREAKER_THRESHOLD/STASH_BREAKER_COOLDOWN")
+		c.StashBreakerThreshold, c.StashBreakerCooldown = old.StashBreakerThreshold, old.StashBreakerCooldown
+	}
+	if c.TelegramUploadTimeout != old.TelegramUploadTimeout || c.TelegramUploadLimitMB != old.TelegramUploadLimitMB {
+		changed = append(changed, "TELEGRAM_UPLOAD_TIMEOUT/TELEGRAM_UPLOAD_LIMIT_MB")
+		c.TelegramUploadTimeout, c.TelegramUploadLimitMB = old.TelegramUploadTimeout, old.TelegramUploadLimitMB
+	}
+	if c.StreamLinkTTL != old.StreamLinkTTL {
+		changed = append(changed, "STREAM_LINK_TTL")
+		c.StreamLinkTTL = old.StreamLinkTTL
+	}
+
+	return changed
+}
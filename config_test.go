@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() Config {
+		config := defaultConfig()
+		config.TelegramToken = "123:abc"
+		config.StashURL = "http://localhost:9999"
+		config.normalize()
+		return config
+	}
+
+	tests := []struct {
+		name    string
+		change  func(*Config)
+		wantErr string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"missing token", func(c *Config) { c.TelegramToken = "" }, "TELEGRAM_BOT_TOKEN"},
+		{"bad stash url", func(c *Config) { c.StashURL = "localhost:9999" }, "STASH_URL"},
+		{"bad bot api url", func(c *Config) { c.TelegramAPIURL = "ftp://x" }, "TELEGRAM_API_URL"},
+		{"upload limit too big", func(c *Config) { c.TelegramUploadLimitMB = 4000 }, "TELEGRAM_UPLOAD_LIMIT_MB"},
+		{"bad preview mode", func(c *Config) { c.PreviewMode = "gif" }, "PREVIEW_MODE"},
+		{"per page too big", func(c *Config) { c.PerPage = 51 }, "PER_PAGE"},
+		{"max delay below delay", func(c *Config) { c.StashRetryMaxDelay = time.Second; c.StashRetryDelay = 2 * time.Second }, "STASH_RETRY_MAX_DELAY"},
+		{"negative rate limit", func(c *Config) { c.RateLimitChat = -1 }, "RATE_LIMIT_CHAT"},
+		{"zero burst", func(c *Config) { c.RateLimitBurst = 0 }, "RATE_LIMIT_BURST"},
+		{"empty message", func(c *Config) { c.Messages.SlowDown = " " }, "messages.slow_down"},
+		{"webhook without url", func(c *Config) { c.UpdateMode = UpdateModeWebhook }, "WEBHOOK_URL"},
+		{"self-signed without cert", func(c *Config) {
+			c.UpdateMode, c.WebhookURL, c.WebhookSelfSigned = UpdateModeWebhook, "https://bot.example.com/hook", true
+		}, "WEBHOOK_SELF_SIGNED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid()
+			tt.change(&config)
+
+			errs := config.validate()
+			if tt.wantErr == "" {
+				if len(errs) > 0 {
+					t.Fatalf("validate() = %v, want no errors", errs)
+				}
+				return
+			}
+
+			for _, err := range errs {
+				if strings.Contains(err.Error(), tt.wantErr) {
+					return
+				}
+			}
+			t.Fatalf("validate() = %v, want error about %s", errs, tt.wantErr)
+		})
+	}
+}
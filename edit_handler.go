@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// handleWriteCallback обрабатывает действия, изменяющие данные в Stash.
+// Такие действия сами отвечают на callback, поэтому возвращают true, если запрос обработан.
+func (h *BotHandler) handleWriteCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) bool {
+	var handle func(context.Context, *bot.Bot, *models.CallbackQuery)
+
+	switch {
+	case strings.HasPrefix(callback.Data, "rate_"):
+		handle = h.handleRateCallback
+	case strings.HasPrefix(callback.Data, "counter_"):
+		handle = h.handleCounterCallback
+	case strings.HasPrefix(callback.Data, "tagedit_"):
+		handle = h.handleTagEditCallback
+	case strings.HasPrefix(callback.Data, "tagrm_"):
+		handle = h.handleTagRemoveCallback
+	case strings.HasPrefix(callback.Data, "tagsearch_"):
+		handle = h.handleTagSearchCallback
+	case strings.HasPrefix(callback.Data, "tagput_"):
+		handle = h.handleTagPutCallback
+	case strings.HasPrefix(callback.Data, "tagdone_"):
+		handle = h.handleTagDoneCallback
+	default:
+		return false
+	}
+
+	if !RoleFromContext(ctx).CanWrite() {
+		h.logger.With("user_id", callback.From.ID).Warning("Нет прав на изменение: %s", callback.Data)
+		h.answerCallback(ctx, b, callback, h.config.Get().Messages.NoWriteRight, true)
+		return true
+	}
+
+	handle(ctx, b, callback)
+	return true
+}
+
+// handleRateCallback выставляет оценку сцене (rate_<id>_<звезды>), 0 звезд сбрасывает оценку
+func (h *BotHandler) handleRateCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	sceneID, value, ok := strings.Cut(strings.TrimPrefix(callback.Data, "rate_"), "_")
+	stars, err := strconv.Atoi(value)
+	if !ok || err != nil || stars < 0 || stars > 5 {
+		h.answerCallback(ctx, b, callback, "", false)
+		return
+	}
+
+	input := SceneUpdateInput{ID: sceneID, ClearRating: stars == 0}
+	rating100 := stars * 20
+	if stars > 0 {
+		input.Rating100 = &rating100
+	}
+
+	scene, err := h.stash.UpdateScene(ctx, input)
+	if err != nil {
+		h.logger.Error("Ошибка изменения оценки сцены %s: %v", sceneID, err)
+		h.answerStashError(ctx, b, callback, "❌ Не удалось сохранить оценку: ", err)
+		return
+	}
+
+	answer := "Оценка: " + ratingStars(rating100)
+	if stars == 0 {
+		answer = "Оценка сброшена"
+	}
+	h.logger.With("user_id", callback.From.ID, "scene_id", sceneID).Success("Оценка сцены: %d", rating100)
+	h.answerCallback(ctx, b, callback, answer, false)
+	h.refreshSceneMessage(ctx, b, callback.Message.Message, scene, h.sceneKeyboard(ctx, scene))
+}
+
+// handleCounterCallback изменяет O-счетчик или счетчик просмотров (counter_<действие>_<id>)
+func (h *BotHandler) handleCounterCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	action, sceneID, ok := strings.Cut(strings.TrimPrefix(callback.Data, "counter_"), "_")
+	if !ok {
+		h.answerCallback(ctx, b, callback, "", false)
+		return
+	}
+
+	var (
+		update func(context.Context, string) (int, error)
+		label  string
+	)
+	switch action {
+	case "oinc", "odec":
+		update, label = h.stash.IncrementO, "💦 O-счетчик"
+		if action == "odec" {
+			update = h.stash.DecrementO
+		}
+	case "playadd", "playdel":
+		update, label = h.stash.AddPlay, "👁 Просмотры"
+		if action == "playdel" {
+			update = h.stash.DeletePlay
+		}
+	default:
+		h.answerCallback(ctx, b, callback, "", false)
+		return
+	}
+
+	count, err := update(ctx, sceneID)
+	if err != nil {
+		h.logger.Error("Ошибка изменения счетчика сцены %s: %v", sceneID, err)
+		h.answerStashError(ctx, b, callback, "❌ Не удалось обновить счетчик: ", err)
+		return
+	}
+
+	h.logger.With("user_id", callback.From.ID, "scene_id", sceneID).Success("%s: %d", label, count)
+	h.answerCallback(ctx, b, callback, fmt.Sprintf("%s: %d", label, count), false)
+
+	scene, err := h.stash.FindScene(ctx, sceneID)
+	if err != nil {
+		h.logger.Warning("Не удалось получить сцену %s: %v", sceneID, err)
+		return
+	}
+	h.refreshSceneMessage(ctx, b, callback.Message.Message, scene, h.sceneKeyboard(ctx, scene))
+}
+
+// refreshSceneMessage обновляет подпись и клавиатуру сообщения сцены
+func (h *BotHandler) refreshSceneMessage(ctx context.Context, b *bot.Bot, msg *models.Message, scene *Scene, kb *models.InlineKeyboardMarkup) {
+	if msg == nil {
+		return
+	}
+
+	text := formatSceneCaption(scene)
+
+	var err error
+	if msg.Text != "" {
+		_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      msg.Chat.ID,
+			MessageID:   msg.ID,
+			Text:        text,
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: kb,
+		})
+	} else {
+		_, err = b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
+			ChatID:      msg.Chat.ID,
+			MessageID:   msg.ID,
+			Caption:     text,
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: kb,
+		})
+	}
+
+	if err != nil {
+		h.logger.Warning("Не удалось обновить сообщение сцены: %v", err)
+	}
+}
+
+// answerCallback отвечает на callback запрос текстом
+func (h *BotHandler) answerCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery, text string, alert bool) {
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: callback.ID,
+		Text:            text,
+		ShowAlert:       alert,
+	})
+}
@@ -1,76 +1,212 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 // FileManager - менеджер для работы с файлами
 type FileManager struct {
 	dataDir string
+	apiKey  string
+	maxSize int64
+	// timeout ограничивает ожидание ответа Stash и небольшие загрузки целиком;
+	// потоковая передача превью ограничена только таймаутом загрузки в Telegram
+	timeout time.Duration
+	client  *http.Client
 	logger  *Logger
 }
 
-func NewFileManager(dataDir string) *FileManager {
+func NewFileManager(dataDir, apiKey string, maxSize int64, timeout time.Duration) *FileManager {
 	// Создаем директорию если не существует
 	os.MkdirAll(dataDir, 0755)
 
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+
 	return &FileManager{
 		dataDir: dataDir,
+		apiKey:  apiKey,
+		maxSize: maxSize,
+		timeout: timeout,
+		client:  &http.Client{Transport: transport},
 		logger:  NewLogger("FileManager"),
 	}
 }
 
-// DownloadFile загружает файл по URL
-func (fm *FileManager) DownloadFile(url, filename string) (string, error) {
-	filepath := fmt.Sprintf("%s/%s.mp4", fm.dataDir, sanitizeFilename(filename))
+// get загружает файл из Stash, передавая ключ API в заголовке, а не в адресе
+func (fm *FileManager) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	return fm.getRange(ctx, rawURL, "")
+}
+
+// getRange загружает файл или его часть (byteRange в формате заголовка Range)
+func (fm *FileManager) getRange(ctx context.Context, rawURL, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stripAPIKey(rawURL), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if fm.apiKey != "" {
+		req.Header.Set("ApiKey", fm.apiKey)
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+
+	return fm.client.Do(req)
+}
+
+// FileVersion возвращает ETag или Last-Modified файла, не загружая его целиком.
+// Меняется, когда Stash заново генерирует файл (например, превью).
+func (fm *FileManager) FileVersion(ctx context.Context, url string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fm.timeout)
+	defer cancel()
+
+	resp, err := fm.getRange(ctx, url, "bytes=0-0")
+	if err != nil {
+		return "", fmt.Errorf("ошибка запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return "", fmt.Errorf("сервер вернул статус %d", resp.StatusCode)
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag, nil
+	}
+	return resp.Header.Get("Last-Modified"), nil
+}
+
+// stripAPIKey удаляет ключ API из параметров адреса, если Stash добавил его в пути
+func stripAPIKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+	if !query.Has("apikey") {
+		return rawURL
+	}
+
+	query.Del("apikey")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
 
+// OpenFile открывает файл по URL для потоковой передачи.
+// Если сервер сообщил размер, тело ответа отдается напрямую; иначе файл
+// сначала сохраняется на диск, чтобы проверить размер до отправки.
+func (fm *FileManager) OpenFile(ctx context.Context, url, filename string) (io.ReadCloser, error) {
 	fm.logger.Info("Загрузка файла: %s", filename)
 
-	resp, err := http.Get(url)
+	resp, err := fm.get(ctx, url)
 	if err != nil {
 		fm.logger.Error("Ошибка загрузки: %v", err)
-		return "", fmt.Errorf("ошибка загрузки: %w", err)
+		return nil, fmt.Errorf("ошибка загрузки: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
 		fm.logger.Error("Неверный статус: %s", resp.Status)
-		return "", fmt.Errorf("неверный статус: %s", resp.Status)
+		return nil, fmt.Errorf("неверный статус: %s", resp.Status)
+	}
+
+	if resp.ContentLength > fm.maxSize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("файл слишком большой: %.2f MB", float64(resp.ContentLength)/1024/1024)
+	}
+
+	body := newMeteredBody(resp.Body)
+
+	if resp.ContentLength >= 0 {
+		fm.logger.Info("Потоковая передача: %s (%.2f MB)", filename, float64(resp.ContentLength)/1024/1024)
+		return body, nil
 	}
 
-	file, err := os.Create(filepath)
+	defer body.Close()
+	return fm.bufferToDisk(body, filename)
+}
+
+// FetchSmallFile загружает небольшой файл в память, отказываясь от файлов больше limit
+func (fm *FileManager) FetchSmallFile(ctx context.Context, url string, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, fm.timeout)
+	defer cancel()
+
+	resp, err := fm.get(ctx, url)
 	if err != nil {
-		fm.logger.Error("Ошибка создания файла: %v", err)
-		return "", fmt.Errorf("ошибка создания файла: %w", err)
+		return nil, fmt.Errorf("ошибка загрузки: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("неверный статус: %s", resp.Status)
+	}
+
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("файл слишком большой: %d KB", resp.ContentLength/1024)
 	}
-	defer file.Close()
 
-	size, err := io.Copy(file, resp.Body)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
 	if err != nil {
-		fm.logger.Error("Ошибка записи файла: %v", err)
-		return "", fmt.Errorf("ошибка записи файла: %w", err)
+		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
 	}
 
-	fm.logger.Success("Файл загружен: %s (%.2f MB)", filename, float64(size)/1024/1024)
-	return filepath, nil
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("файл слишком большой: больше %d KB", limit/1024)
+	}
+
+	return data, nil
 }
 
-// ReadFile читает файл
-func (fm *FileManager) ReadFile(filepath string) ([]byte, error) {
-	fm.logger.Info("Чтение файла: %s", filepath)
+// bufferToDisk сохраняет поток во временный файл, который удаляется при закрытии
+func (fm *FileManager) bufferToDisk(body io.Reader, filename string) (io.ReadCloser, error) {
+	file, err := os.CreateTemp(fm.dataDir, sanitizeFilename(filename)+"-*.mp4")
+	if err != nil {
+		fm.logger.Error("Ошибка создания файла: %v", err)
+		return nil, fmt.Errorf("ошибка создания файла: %w", err)
+	}
+
+	tmp := &tempFile{File: file, fm: fm}
 
-	data, err := os.ReadFile(filepath)
+	size, err := io.Copy(file, io.LimitReader(body, fm.maxSize+1))
 	if err != nil {
-		fm.logger.Error("Ошибка чтения файла: %v", err)
+		tmp.Close()
+		fm.logger.Error("Ошибка записи файла: %v", err)
+		return nil, fmt.Errorf("ошибка записи файла: %w", err)
+	}
+
+	if size > fm.maxSize {
+		tmp.Close()
+		return nil, fmt.Errorf("файл слишком большой: больше %d MB", fm.maxSize/1024/1024)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
 		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
 	}
 
-	fm.logger.Success("Файл прочитан: %.2f MB", float64(len(data))/1024/1024)
-	return data, nil
+	fm.logger.Success("Файл загружен: %s (%.2f MB)", filename, float64(size)/1024/1024)
+	return tmp, nil
+}
+
+// tempFile временный файл, удаляемый после закрытия
+type tempFile struct {
+	*os.File
+	fm *FileManager
+}
+
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	t.fm.DeleteFile(t.Name())
+	return err
 }
 
 // DeleteFile удаляет файл
@@ -6,8 +6,18 @@ import (
 	"github.com/go-telegram/bot/models"
 )
 
-// CreateSceneKeyboard создает клавиатуру для сцены
-func CreateSceneKeyboard(scene *Scene, streamURL string) *models.InlineKeyboardMarkup {
+const (
+	// sceneKeyboardTags сколько тегов показывать на клавиатуре сцены
+	sceneKeyboardTags = 4
+	// tagMenuPageSize сколько тегов на одной странице меню тегов: Telegram
+	// отклоняет клавиатуру больше чем из 100 кнопок
+	tagMenuPageSize = 40
+)
+
+// CreateSceneKeyboard создает клавиатуру для сцены.
+// Пустые streamURL или webURL убирают соответствующие кнопки, без canWrite
+// не показываются кнопки, изменяющие сцену.
+func CreateSceneKeyboard(scene *Scene, streamURL, webURL string, canWrite bool) *models.InlineKeyboardMarkup {
 	kb := &models.InlineKeyboardMarkup{
 		InlineKeyboard: [][]models.InlineKeyboardButton{},
 	}
@@ -45,25 +55,362 @@ func CreateSceneKeyboard(scene *Scene, streamURL string) *models.InlineKeyboardM
 		}
 	}
 
-	// Кнопка стрима
+	// Кнопки тегов, остальные теги - в отдельном меню
+	if len(scene.Tags) > 0 {
+		shown := scene.Tags
+		if len(shown) > sceneKeyboardTags {
+			shown = shown[:sceneKeyboardTags]
+		}
+
+		kb.InlineKeyboard = append(kb.InlineKeyboard, tagRows(shown)...)
+
+		if len(scene.Tags) > sceneKeyboardTags {
+			kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+				{
+					Text:         fmt.Sprintf("🏷 Ещё теги (%d)", len(scene.Tags)-sceneKeyboardTags),
+					CallbackData: fmt.Sprintf("tags_%s", scene.ID),
+				},
+			})
+		}
+	}
+
+	// Маркеры сцены
+	if len(scene.SceneMarkers) > 0 {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("📍 Маркеры (%d)", len(scene.SceneMarkers)),
+				CallbackData: fmt.Sprintf("markers_%s", scene.ID),
+			},
+		})
+	}
+
+	// Редактирование тегов и оценка сцены
+	if canWrite {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{
+				Text:         "✏️ Изменить теги",
+				CallbackData: fmt.Sprintf("tagedit_%s", scene.ID),
+			},
+		})
+		kb.InlineKeyboard = append(kb.InlineKeyboard, ratingRow(scene))
+	}
+
+	// Счетчики
+	if canWrite {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{Text: "💦 +1", CallbackData: fmt.Sprintf("counter_oinc_%s", scene.ID)},
+			{Text: "💦 −1", CallbackData: fmt.Sprintf("counter_odec_%s", scene.ID)},
+			{Text: "👁 +1", CallbackData: fmt.Sprintf("counter_playadd_%s", scene.ID)},
+			{Text: "👁 −1", CallbackData: fmt.Sprintf("counter_playdel_%s", scene.ID)},
+		})
+	}
+
+	// Ссылки на сцену в Stash и на стрим
+	if links := linkRow(webURL, "🌐 Открыть в Stash", streamURL); len(links) > 0 {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, links)
+	}
+
+	// Кнопка случайного видео
 	kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
 		{
-			Text: "🔗 Открыть стрим",
-			URL:  streamURL,
+			Text:         "🎲 Случайное",
+			CallbackData: "random",
 		},
 	})
 
-	// Кнопка случайного видео
+	return kb
+}
+
+// ratingRow создает ряд звезд для оценки сцены с отметкой текущей оценки
+// и кнопкой сброса, если оценка выставлена
+func ratingRow(scene *Scene) []models.InlineKeyboardButton {
+	current := 0
+	if scene.Rating100 != nil {
+		current = ratingToStars(*scene.Rating100)
+	}
+
+	row := []models.InlineKeyboardButton{}
+	for stars := 1; stars <= 5; stars++ {
+		text := "☆"
+		if stars <= current {
+			text = "★"
+		}
+		row = append(row, models.InlineKeyboardButton{
+			Text:         text,
+			CallbackData: fmt.Sprintf("rate_%s_%d", scene.ID, stars),
+		})
+	}
+
+	if scene.Rating100 != nil {
+		row = append(row, models.InlineKeyboardButton{
+			Text:         "✖️",
+			CallbackData: fmt.Sprintf("rate_%s_0", scene.ID),
+		})
+	}
+
+	return row
+}
+
+// CreateTagsKeyboard создает меню со всеми тегами сцены, по tagMenuPageSize на странице
+func CreateTagsKeyboard(scene *Scene, page int) *models.InlineKeyboardMarkup {
+	totalPages := (len(scene.Tags) + tagMenuPageSize - 1) / tagMenuPageSize
+	page = max(min(page, totalPages), 1)
+	start := (page - 1) * tagMenuPageSize
+	end := min(start+tagMenuPageSize, len(scene.Tags))
+
+	kb := &models.InlineKeyboardMarkup{
+		InlineKeyboard: tagRows(scene.Tags[start:end]),
+	}
+
+	if row := paginationRow(fmt.Sprintf("tags_%s_", scene.ID), page, totalPages); row != nil {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, row)
+	}
+
 	kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
 		{
-			Text:         "🎲 Случайное",
-			CallbackData: "random",
+			Text:         "◀️ Назад",
+			CallbackData: fmt.Sprintf("back_%s", scene.ID),
 		},
 	})
 
 	return kb
 }
 
+// CreateTagEditorKeyboard создает редактор тегов сцены, по tagMenuPageSize тегов на странице
+func CreateTagEditorKeyboard(scene *Scene, page int) *models.InlineKeyboardMarkup {
+	kb := &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{},
+	}
+
+	totalPages := (len(scene.Tags) + tagMenuPageSize - 1) / tagMenuPageSize
+	page = max(min(page, totalPages), 1)
+	start := (page - 1) * tagMenuPageSize
+	end := min(start+tagMenuPageSize, len(scene.Tags))
+
+	// Кнопка удаления для каждого тега
+	for _, tag := range scene.Tags[start:end] {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("❌ %s", tag.Name),
+				CallbackData: fmt.Sprintf("tagrm_%s_%s", scene.ID, tag.ID),
+			},
+		})
+	}
+
+	if row := paginationRow(fmt.Sprintf("tagedit_%s_", scene.ID), page, totalPages); row != nil {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, row)
+	}
+
+	kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+		{Text: "➕ Добавить тег", CallbackData: fmt.Sprintf("tagsearch_%s", scene.ID)},
+		{Text: "✅ Готово", CallbackData: fmt.Sprintf("tagdone_%s", scene.ID)},
+	})
+
+	return kb
+}
+
+// CreateTagPickerKeyboard создает список найденных тегов для добавления к сцене
+func CreateTagPickerKeyboard(sceneID string, tags []Tag) *models.InlineKeyboardMarkup {
+	kb := &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{},
+	}
+
+	for _, tag := range tags {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("➕ %s", tag.Name),
+				CallbackData: fmt.Sprintf("tagput_%s_%s", sceneID, tag.ID),
+			},
+		})
+	}
+
+	kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+		{Text: "🔍 Искать снова", CallbackData: fmt.Sprintf("tagsearch_%s", sceneID)},
+	})
+
+	return kb
+}
+
+// tagRows создает кнопки тегов по две в ряд
+func tagRows(tags []Tag) [][]models.InlineKeyboardButton {
+	rows := [][]models.InlineKeyboardButton{}
+	row := []models.InlineKeyboardButton{}
+
+	for i, tag := range tags {
+		if i > 0 && i%2 == 0 {
+			rows = append(rows, row)
+			row = []models.InlineKeyboardButton{}
+		}
+
+		row = append(row, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf("🏷 %s", tag.Name),
+			CallbackData: fmt.Sprintf("tag_%s", tag.ID),
+		})
+	}
+
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// CreateSearchKeyboard создает клавиатуру со списком найденных сцен
+func CreateSearchKeyboard(scenes []Scene, ref string, page, totalPages int) *models.InlineKeyboardMarkup {
+	kb := &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{},
+	}
+
+	kb.InlineKeyboard = append(kb.InlineKeyboard, sceneButtons(scenes)...)
+
+	if row := paginationRow("search_"+ref+"_", page, totalPages); row != nil {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, row)
+	}
+
+	return kb
+}
+
+// CreateBrowseKeyboard создает клавиатуру для подборки видео исполнителя или студии
+func CreateBrowseKeyboard(kind, id string, scenes []Scene, page, totalPages int) *models.InlineKeyboardMarkup {
+	kb := &models.InlineKeyboardMarkup{
+		InlineKeyboard: sceneButtons(scenes),
+	}
+
+	prefix := fmt.Sprintf("browse_%s_%s_", kind, id)
+	if row := paginationRow(prefix, page, totalPages); row != nil {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, row)
+	}
+
+	// Кнопка случайного видео из подборки
+	kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+		{
+			Text:         "🎲 Случайное из подборки",
+			CallbackData: fmt.Sprintf("brandom_%s_%s", kind, id),
+		},
+	})
+
+	return kb
+}
+
+// sceneButtons создает по кнопке для каждой сцены из списка
+func sceneButtons(scenes []Scene) [][]models.InlineKeyboardButton {
+	rows := [][]models.InlineKeyboardButton{}
+	for i := range scenes {
+		rows = append(rows, []models.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("🎬 %s", truncateString(scenes[i].DisplayTitle(), 48)),
+				CallbackData: fmt.Sprintf("scene_%s", scenes[i].ID),
+			},
+		})
+	}
+	return rows
+}
+
+// paginationRow создает ряд кнопок навигации по страницам
+func paginationRow(prefix string, page, totalPages int) []models.InlineKeyboardButton {
+	if totalPages <= 1 {
+		return nil
+	}
+
+	row := []models.InlineKeyboardButton{}
+
+	if page > 1 {
+		row = append(row, models.InlineKeyboardButton{
+			Text:         "◀️",
+			CallbackData: fmt.Sprintf("%s%d", prefix, page-1),
+		})
+	}
+
+	row = append(row, models.InlineKeyboardButton{
+		Text:         fmt.Sprintf("%d / %d", page, totalPages),
+		CallbackData: "noop",
+	})
+
+	if page < totalPages {
+		row = append(row, models.InlineKeyboardButton{
+			Text:         "▶️",
+			CallbackData: fmt.Sprintf("%s%d", prefix, page+1),
+		})
+	}
+
+	return row
+}
+
+// CreateMarkerListKeyboard создает список маркеров с кнопкой отправки клипа для каждого
+func CreateMarkerListKeyboard(markers []SceneMarker, navigation []models.InlineKeyboardButton) *models.InlineKeyboardMarkup {
+	kb := &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{},
+	}
+
+	for i := range markers {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("📍 %s · %s", truncateString(markers[i].DisplayTitle(), 40), formatDuration(markers[i].Seconds)),
+				CallbackData: fmt.Sprintf("marker_%s_%s", markers[i].Scene.ID, markers[i].ID),
+			},
+		})
+	}
+
+	if navigation != nil {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, navigation)
+	}
+
+	return kb
+}
+
+// CreateMarkerTagsKeyboard создает список тегов, у которых есть маркеры
+func CreateMarkerTagsKeyboard(tags []Tag, page, totalPages int) *models.InlineKeyboardMarkup {
+	kb := &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{},
+	}
+
+	for _, tag := range tags {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{
+				Text:         fmt.Sprintf("🏷 %s (%d)", tag.Name, tag.SceneMarkerCount),
+				CallbackData: fmt.Sprintf("mtag_%s_1", tag.ID),
+			},
+		})
+	}
+
+	if row := paginationRow("mtags_", page, totalPages); row != nil {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, row)
+	}
+
+	return kb
+}
+
+// CreateMarkerKeyboard создает клавиатуру для клипа маркера.
+// webURL открывает сцену в Stash с момента начала маркера.
+func CreateMarkerKeyboard(marker *SceneMarker, streamURL, webURL string) *models.InlineKeyboardMarkup {
+	kb := &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{
+			{
+				{Text: "🎬 Открыть видео", CallbackData: fmt.Sprintf("scene_%s", marker.Scene.ID)},
+			},
+		},
+	}
+
+	webText := fmt.Sprintf("▶️ В Stash с %s", formatDuration(marker.Seconds))
+	if links := linkRow(webURL, webText, streamURL); len(links) > 0 {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, links)
+	}
+
+	return kb
+}
+
+// linkRow создает ряд кнопок-ссылок на веб-интерфейс Stash и стрим, пропуская пустые
+func linkRow(webURL, webText, streamURL string) []models.InlineKeyboardButton {
+	row := []models.InlineKeyboardButton{}
+	if webURL != "" {
+		row = append(row, models.InlineKeyboardButton{Text: webText, URL: webURL})
+	}
+	if streamURL != "" {
+		row = append(row, models.InlineKeyboardButton{Text: "🔗 Открыть стрим", URL: streamURL})
+	}
+	return row
+}
+
 // CreateHelpKeyboard создает клавиатуру для справки
 func CreateHelpKeyboard() *models.InlineKeyboardMarkup {
 	return &models.InlineKeyboardMarkup{
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// sceneWebURL возвращает ссылку на страницу сцены в веб-интерфейсе Stash
+func (h *BotHandler) sceneWebURL(sceneID string) string {
+	return fmt.Sprintf("%s/scenes/%s", h.config.Get().StashPublicURL, url.PathEscape(sceneID))
+}
+
+// markerWebURL возвращает ссылку на сцену маркера с переходом к его началу
+func (h *BotHandler) markerWebURL(marker *SceneMarker) string {
+	return fmt.Sprintf("%s?t=%d", h.sceneWebURL(marker.Scene.ID), int(marker.Seconds))
+}
+
+// streamURL возвращает подписанную для пользователя ссылку на стрим или пустую строку, если кнопка
+// отключена или встроенный сервер стрима не запущен: отдавать ссылки было бы некому.
+// Пользователю с доступом только через ALLOWED_CHATS ссылка тоже не выдается: сервер
+// стрима не знает чата и такую ссылку отклонит.
+// Ссылки Stash на стрим в чаты не отдаются: они ведут во внутреннюю сеть и могут содержать ключ API.
+func (h *BotHandler) streamURL(ctx context.Context, path string) string {
+	if config := h.config.Get(); !config.StreamButton || config.StreamListen == "" || config.StreamPublicURL == "" {
+		return ""
+	}
+	if !PersonalAccessFromContext(ctx) {
+		return ""
+	}
+	return h.streams.SignedURL(path, UserIDFromContext(ctx))
+}
+
+// sceneKeyboard создает клавиатуру сцены со ссылками текущей конфигурации
+func (h *BotHandler) sceneKeyboard(ctx context.Context, scene *Scene) *models.InlineKeyboardMarkup {
+	canWrite := RoleFromContext(ctx).CanWrite()
+	return CreateSceneKeyboard(scene, h.streamURL(ctx, sceneStreamPath(scene.ID)), h.sceneWebURL(scene.ID), canWrite)
+}
+
+// markerKeyboard создает клавиатуру маркера со ссылками текущей конфигурации
+func (h *BotHandler) markerKeyboard(ctx context.Context, marker *SceneMarker) *models.InlineKeyboardMarkup {
+	return CreateMarkerKeyboard(marker, h.streamURL(ctx, markerStreamPath(marker)), h.markerWebURL(marker))
+}
@@ -1,37 +1,277 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
 )
 
+// LogFormat формат вывода логов
+type LogFormat string
+
+const (
+	LogFormatConsole LogFormat = "console"
+	LogFormatJSON    LogFormat = "json"
+)
+
+// LevelSuccess уровень для сообщений об успешно выполненных действиях (между INFO и WARN)
+const LevelSuccess = slog.Level(2)
+
+var (
+	// logLevel текущий уровень логирования, меняется при перезагрузке конфигурации
+	logLevel slog.LevelVar
+	// logRoot общий логгер, в который пишут все компоненты
+	logRoot atomic.Pointer[slog.Logger]
+)
+
+func init() {
+	logRoot.Store(slog.New(newConsoleHandler(os.Stdout, &logLevel)))
+}
+
+// SetupLogging выбирает формат и уровень логов
+func SetupLogging(format LogFormat, level slog.Level) {
+	logLevel.Set(level)
+
+	var handler slog.Handler
+	switch format {
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level:       &logLevel,
+			ReplaceAttr: replaceLevelName,
+		})
+	default:
+		handler = newConsoleHandler(os.Stdout, &logLevel)
+	}
+
+	logRoot.Store(slog.New(handler))
+}
+
+// SetLogLevel меняет уровень логирования на лету
+func SetLogLevel(level slog.Level) {
+	logLevel.Set(level)
+}
+
+// parseLogLevel разбирает название уровня логирования
+func parseLogLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(value) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("неизвестный уровень логирования: %s", value)
+	}
+}
+
+// replaceLevelName подписывает уровень SUCCESS в JSON логах
+func replaceLevelName(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := attr.Value.Any().(slog.Level); ok && level == LevelSuccess {
+			attr.Value = slog.StringValue("SUCCESS")
+		}
+	}
+	return attr
+}
+
 // Logger - обертка для красивого логирования
 type Logger struct {
 	prefix string
+	attrs  []any
 }
 
 func NewLogger(prefix string) *Logger {
 	return &Logger{prefix: prefix}
 }
 
+// With возвращает логгер, добавляющий поля к каждому сообщению (user_id, chat_id, scene_id...)
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{
+		prefix: l.prefix,
+		attrs:  append(append([]any{}, l.attrs...), args...),
+	}
+}
+
+func (l *Logger) Debug(format string, args ...interface{}) {
+	l.log(slog.LevelDebug, format, args...)
+}
+
 func (l *Logger) Info(format string, args ...interface{}) {
-	timestamp := time.Now().Format("15:04:05")
-	color.Cyan("[%s] [%s INFO] %s", timestamp, l.prefix, fmt.Sprintf(format, args...))
+	l.log(slog.LevelInfo, format, args...)
 }
 
 func (l *Logger) Success(format string, args ...interface{}) {
-	timestamp := time.Now().Format("15:04:05")
-	color.Green("[%s] [%s SUCCESS] ✓ %s", timestamp, l.prefix, fmt.Sprintf(format, args...))
+	l.log(LevelSuccess, format, args...)
 }
 
 func (l *Logger) Error(format string, args ...interface{}) {
-	timestamp := time.Now().Format("15:04:05")
-	color.Red("[%s] [%s ERROR] ✗ %s", timestamp, l.prefix, fmt.Sprintf(format, args...))
+	l.log(slog.LevelError, format, args...)
 }
 
 func (l *Logger) Warning(format string, args ...interface{}) {
-	timestamp := time.Now().Format("15:04:05")
-	color.Yellow("[%s] [%s WARN] ⚠ %s", timestamp, l.prefix, fmt.Sprintf(format, args...))
+	l.log(slog.LevelWarn, format, args...)
+}
+
+func (l *Logger) log(level slog.Level, format string, args ...interface{}) {
+	root := logRoot.Load()
+	ctx := context.Background()
+	if !root.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := append([]any{slog.String("component", l.prefix)}, l.attrs...)
+	root.Log(ctx, level, fmt.Sprintf(format, args...), attrs...)
+}
+
+// consoleHandler выводит логи в прежнем цветном формате:
+// [15:04:05] [Компонент LEVEL] ✓ сообщение key=value
+type consoleHandler struct {
+	out   io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+	mu    *sync.Mutex
+}
+
+func newConsoleHandler(out io.Writer, level slog.Leveler) *consoleHandler {
+	return &consoleHandler{out: out, level: level, mu: &sync.Mutex{}}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var (
+		component string
+		fields    strings.Builder
+	)
+
+	add := func(attr slog.Attr) bool {
+		if attr.Key == "component" {
+			component = attr.Value.String()
+			return true
+		}
+		fmt.Fprintf(&fields, " %s=%v", attr.Key, attr.Value.Any())
+		return true
+	}
+	for _, attr := range h.attrs {
+		add(attr)
+	}
+	record.Attrs(add)
+
+	label, mark, paint := consoleLevelStyle(record.Level)
+	line := fmt.Sprintf("[%s] [%s %s] %s%s%s",
+		record.Time.Format("15:04:05"), component, label, mark, record.Message, fields.String())
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := paint.Fprintln(h.out, line)
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &consoleHandler{
+		out:   h.out,
+		level: h.level,
+		attrs: append(append([]slog.Attr{}, h.attrs...), attrs...),
+		mu:    h.mu,
+	}
+}
+
+func (h *consoleHandler) WithGroup(string) slog.Handler {
+	// Группы в консоли не нужны: поля выводятся плоским списком
+	return h
+}
+
+// consoleLevelStyle возвращает подпись, значок и цвет уровня
+func consoleLevelStyle(level slog.Level) (string, string, *color.Color) {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR", "✗ ", color.New(color.FgRed)
+	case level >= slog.LevelWarn:
+		return "WARN", "⚠ ", color.New(color.FgYellow)
+	case level >= LevelSuccess:
+		return "SUCCESS", "✓ ", color.New(color.FgGreen)
+	case level >= slog.LevelInfo:
+		return "INFO", "", color.New(color.FgCyan)
+	default:
+		return "DEBUG", "", color.New(color.FgHiBlack)
+	}
+}
+
+// durationField поле с длительностью операции в миллисекундах
+func durationField(start time.Time) slog.Attr {
+	return slog.Int64("duration_ms", time.Since(start).Milliseconds())
+}
+
+// updateLogger логгер обработанных обновлений
+var updateLogger = NewLogger("Update")
+
+// LogMiddleware пишет в лог каждое обработанное обновление с пользователем, чатом и длительностью
+func LogMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		start := time.Now()
+		next(ctx, b, update)
+
+		userID, chatID, ok := updateSource(update)
+		if !ok {
+			return
+		}
+
+		updateLogger.With(
+			"user_id", userID,
+			"chat_id", chatID,
+			"update", updateKind(update),
+			durationField(start),
+		).Debug("Обновление обработано")
+	}
+}
+
+// knownCommands команды бота, которые различаются в логах и метриках
+var knownCommands = map[string]bool{
+	"/start": true, "/info": true, "/random": true, "/search": true, "/markers": true,
+}
+
+// knownCallbacks префиксы callback данных, которые различаются в логах и метриках
+var knownCallbacks = map[string]bool{
+	"random": true, "noop": true, "performer": true, "studio": true, "tag": true, "tags": true,
+	"back": true, "scene": true, "search": true, "browse": true, "brandom": true,
+	"markers": true, "marker": true, "mtags": true, "mtag": true,
+	"rate": true, "counter": true, "tagedit": true, "tagrm": true, "tagsearch": true, "tagput": true, "tagdone": true,
+}
+
+// updateKind кратко описывает обновление: "command:/random", "callback:scene" или "message".
+// Набор значений ограничен известными командами и префиксами, чтобы пользователь
+// не мог плодить метки метрик произвольными командами.
+func updateKind(update *models.Update) string {
+	switch {
+	case update.CallbackQuery != nil:
+		prefix, _, _ := strings.Cut(update.CallbackQuery.Data, "_")
+		if !knownCallbacks[prefix] {
+			prefix = "other"
+		}
+		return "callback:" + prefix
+	case update.Message != nil && strings.HasPrefix(update.Message.Text, "/"):
+		name, _, _ := parseCommand(update.Message.Text)
+		command := "/" + name
+		if !knownCommands[command] {
+			command = "other"
+		}
+		return "command:" + command
+	default:
+		return "message"
+	}
 }
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -14,26 +17,56 @@ func main() {
 	logger := NewLogger("Main")
 
 	// Загружаем конфигурацию
-	config := LoadConfig()
+	config, err := LoadConfig()
+	if err != nil {
+		logger.Error("%v", err)
+		os.Exit(1)
+	}
+
+	level, _ := parseLogLevel(config.LogLevel)
+	SetupLogging(config.LogFormat, level)
 
 	// Проверяем подключение к StashApp
 	logger.Info("Проверка подключения к StashApp: %s", config.StashURL)
-	testClient := NewStashClient(config.StashURL, config.StashAPIKey)
+	testClient := NewStashClient(config)
 
-	if err := testClient.TestConnection(); err != nil {
+	if err := testClient.TestConnection(context.Background()); err != nil {
 		logger.Warning("Не удалось подключиться к StashApp: %v", err)
 		logger.Info("Бот запущен, но может не работать до устранения проблемы")
 	} else {
 		logger.Success("Успешно подключено к StashApp!")
 	}
 
+	if config.StreamButton && config.StreamListen == "" {
+		logger.Warning("STREAM_LISTEN не задан, кнопка стрима скрыта")
+	} else if config.StreamButton && config.StreamPublicURL == "" {
+		logger.Warning("STREAM_PUBLIC_URL не задан, кнопка стрима скрыта")
+	} else if config.StreamButton && config.StreamSecret == "" {
+		logger.Warning("STREAM_SECRET не задан, ссылки на стрим перестанут работать после перезапуска")
+	}
+
 	// Создаем обработчик
-	handler := NewBotHandler(config)
+	streams := NewStreamSigner(config.StreamPublicURL, config.StreamSecret, config.StreamLinkTTL)
+	store := NewConfigStore(config)
+	handler := NewBotHandler(store, streams)
+	access := NewAccessControl(store)
+	limiter := NewRateLimiter(store)
+	store.OnReload(func(config *Config) {
+		level, _ := parseLogLevel(config.LogLevel)
+		SetLogLevel(level)
+	})
 
 	// Создаем бота
 	opts := []bot.Option{
-		bot.WithDefaultHandler(handler.HandleMessage),
-		bot.WithCallbackQueryDataHandler("", bot.MatchTypePrefix, handler.HandleCallback),
+		bot.WithMiddlewares(LogMiddleware, access.Middleware, MetricsMiddleware),
+		bot.WithServerURL(config.TelegramAPIURL),
+		bot.WithHTTPClient(time.Minute, &http.Client{Timeout: time.Minute, Transport: newTelegramTransport()}),
+		// Текст без команды - поиск, и он тоже обращается к Stash
+		bot.WithDefaultHandler(limiter.Limit(handler.HandleMessage)),
+		bot.WithCallbackQueryDataHandler("", bot.MatchTypePrefix, limiter.Limit(handler.HandleCallback)),
+	}
+	if config.UpdateMode == UpdateModeWebhook {
+		opts = append(opts, bot.WithWebhookSecretToken(config.WebhookSecret))
 	}
 
 	b, err := bot.New(config.TelegramToken, opts...)
@@ -43,9 +76,12 @@ func main() {
 	}
 
 	// Регистрируем команды
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/start", bot.MatchTypeExact, handler.HandleStart)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/info", bot.MatchTypeExact, handler.HandleInfo)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/random", bot.MatchTypeExact, handler.HandleRandom)
+	// (в группах команды приходят как /search@BotName, поэтому сравниваем только имя)
+	b.RegisterHandlerMatchFunc(matchCommand("start"), handler.HandleStart)
+	b.RegisterHandlerMatchFunc(matchCommand("info"), handler.HandleInfo)
+	b.RegisterHandlerMatchFunc(matchCommand("random"), limiter.Limit(handler.HandleRandom))
+	b.RegisterHandlerMatchFunc(matchCommand("search"), limiter.Limit(handler.HandleSearch))
+	b.RegisterHandlerMatchFunc(matchCommand("markers"), limiter.Limit(handler.HandleMarkers))
 
 	// Устанавливаем команды в меню бота
 	b.SetMyCommands(context.Background(), &bot.SetMyCommandsParams{
@@ -53,13 +89,44 @@ func main() {
 			{Command: "start", Description: "Начать работу с ботом"},
 			{Command: "info", Description: "Информация о боте"},
 			{Command: "random", Description: "Случайное видео"},
+			{Command: "search", Description: "Поиск видео"},
+			{Command: "markers", Description: "Маркеры по тегам"},
 		},
 	})
 
 	// Создаем контекст для graceful shutdown
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
+	// Несохраненные изменения кэша превью записываются при остановке
+	defer handler.previews.Flush()
+
+	// Перезагрузка конфигурации по SIGHUP и при изменении файла
+	go store.Watch(ctx)
+
+	// Проверка связи со Stash, пока запросы к нему приостановлены
+	go handler.stash.WatchAvailability(ctx)
+
+	// Запускаем сервер метрик и проверки состояния
+	if config.MetricsListen != "" {
+		health := NewHealthChecker(handler.stash, 30*time.Second)
+		go func() {
+			if err := RunMetricsServer(ctx, config.MetricsListen, health); err != nil {
+				logger.Error("%v", err)
+			}
+		}()
+	}
+
+	// Запускаем встроенный сервер стрима
+	if config.StreamListen != "" {
+		server := NewStreamServer(config, streams, access)
+		go func() {
+			if err := server.Run(ctx, config.StreamListen); err != nil {
+				logger.Error("%v", err)
+			}
+		}()
+	}
+
 	// Получаем информацию о боте
 	me, err := b.GetMe(context.Background())
 
@@ -70,6 +137,28 @@ func main() {
 	}
 
 	// Запускаем бота
+	if config.UpdateMode == UpdateModeWebhook {
+		webhook := NewWebhookServer(config)
+		if err := webhook.Register(ctx, b); err != nil {
+			logger.Error("%v", err)
+			panic(err)
+		}
+
+		go b.StartWebhook(ctx)
+
+		logger.Success("Бот запущен успешно (вебхук)!")
+		if err := webhook.Run(ctx, b); err != nil {
+			logger.Error("%v", err)
+			panic(err)
+		}
+		return
+	}
+
+	// Long polling не работает, пока установлен вебхук
+	if _, err := b.DeleteWebhook(ctx, &bot.DeleteWebhookParams{}); err != nil {
+		logger.Warning("Не удалось удалить вебхук: %v", err)
+	}
+
 	logger.Success("Бот запущен успешно!")
 	b.Start(ctx)
 }
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// HandleMarkers обработчик команды /markers
+func (h *BotHandler) HandleMarkers(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.sendMarkerTagsPage(ctx, b, update.Message.Chat.ID, 0, 1)
+}
+
+// handleSceneMarkersCallback показывает маркеры сцены (markers_<id>) и переключает
+// их страницы (markers_<id>_<страница>), редактируя уже отправленный список
+func (h *BotHandler) handleSceneMarkersCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	perPage := h.config.Get().PerPage
+	msg := callback.Message.Message
+	chatID := msg.Chat.ID
+
+	sceneID, value, paged := strings.Cut(strings.TrimPrefix(callback.Data, "markers_"), "_")
+	page := 1
+	if paged {
+		var err error
+		if page, err = strconv.Atoi(value); err != nil || page < 1 {
+			return
+		}
+	}
+
+	markers, err := h.stash.SceneMarkers(ctx, sceneID)
+	if err != nil {
+		h.logger.Error("Ошибка получения маркеров сцены %s: %v", sceneID, err)
+		h.replyStashError(ctx, b, chatID, "❌ Ошибка: ", err)
+		return
+	}
+
+	if len(markers) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "📍 У этого видео нет маркеров",
+		})
+		return
+	}
+
+	totalPages := (len(markers) + perPage - 1) / perPage
+	page = min(page, totalPages)
+	start := (page - 1) * perPage
+	shown := markers[start:min(start+perPage, len(markers))]
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📍 <b>Маркеры</b>: %d\n\n", len(markers))
+	writeMarkerList(&sb, shown, start)
+
+	kb := CreateMarkerListKeyboard(shown, paginationRow(fmt.Sprintf("markers_%s_", sceneID), page, totalPages))
+
+	if paged {
+		b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      chatID,
+			MessageID:   msg.ID,
+			Text:        sb.String(),
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: kb,
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        sb.String(),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: kb,
+	})
+}
+
+// handleMarkerTagsCallback переключает страницу списка тегов с маркерами (mtags_<страница>)
+func (h *BotHandler) handleMarkerTagsCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	msg := callback.Message.Message
+	if msg == nil {
+		return
+	}
+
+	page, err := strconv.Atoi(strings.TrimPrefix(callback.Data, "mtags_"))
+	if err != nil || page < 1 {
+		return
+	}
+
+	h.sendMarkerTagsPage(ctx, b, msg.Chat.ID, msg.ID, page)
+}
+
+// handleTagMarkersCallback показывает маркеры с основным тегом (mtag_<id тега>_<страница>)
+func (h *BotHandler) handleTagMarkersCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	perPage := h.config.Get().PerPage
+
+	msg := callback.Message.Message
+	if msg == nil {
+		return
+	}
+
+	tagID, value, ok := strings.Cut(strings.TrimPrefix(callback.Data, "mtag_"), "_")
+	page, err := strconv.Atoi(value)
+	if !ok || err != nil || page < 1 {
+		return
+	}
+
+	result, err := h.stash.FindSceneMarkersByTag(ctx, tagID, FindFilter{Page: page, PerPage: perPage})
+	if err != nil {
+		h.logger.Error("Ошибка получения маркеров тега %s: %v", tagID, err)
+		h.replyStashError(ctx, b, msg.Chat.ID, "❌ Ошибка: ", err)
+		return
+	}
+
+	title := "🏷 Тег"
+	if tag, err := h.stash.FindTag(ctx, tagID); err == nil {
+		title = "🏷 " + tag.Name
+	}
+
+	totalPages := (result.Count + perPage - 1) / perPage
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📍 <b>%s</b>: %d маркеров\n\n", escapeHTML(title), result.Count)
+	writeMarkerList(&sb, result.SceneMarkers, (page-1)*perPage)
+
+	kb := CreateMarkerListKeyboard(result.SceneMarkers, paginationRow(fmt.Sprintf("mtag_%s_", tagID), page, totalPages))
+	kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+		{Text: "◀️ К тегам", CallbackData: "mtags_1"},
+	})
+
+	b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.ID,
+		Text:        sb.String(),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: kb,
+	})
+}
+
+// handleMarkerCallback отправляет клип маркера (marker_<id сцены>_<id маркера>)
+func (h *BotHandler) handleMarkerCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	chatID := callback.Message.Message.Chat.ID
+
+	sceneID, markerID, ok := strings.Cut(strings.TrimPrefix(callback.Data, "marker_"), "_")
+	if !ok {
+		return
+	}
+
+	markers, err := h.stash.SceneMarkers(ctx, sceneID)
+	if err != nil {
+		h.logger.Error("Ошибка получения маркеров сцены %s: %v", sceneID, err)
+		h.replyStashError(ctx, b, chatID, "❌ Ошибка: ", err)
+		return
+	}
+
+	for i := range markers {
+		if markers[i].ID == markerID {
+			h.sendMarker(ctx, b, chatID, &markers[i])
+			return
+		}
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "❌ Маркер не найден",
+	})
+}
+
+// sendMarkerTagsPage отправляет страницу тегов, у которых есть маркеры,
+// а при messageID != 0 редактирует существующее сообщение
+func (h *BotHandler) sendMarkerTagsPage(ctx context.Context, b *bot.Bot, chatID int64, messageID int, page int) {
+	perPage := h.config.Get().PerPage
+
+	result, err := h.stash.FindMarkerTags(ctx, FindFilter{
+		Page:      page,
+		PerPage:   perPage,
+		Sort:      "scene_markers_count",
+		Direction: "DESC",
+	})
+	if err != nil {
+		h.logger.Error("Ошибка получения тегов маркеров: %v", err)
+		h.replyStashError(ctx, b, chatID, "❌ Ошибка: ", err)
+		return
+	}
+
+	if result.Count == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "📍 В библиотеке нет маркеров",
+		})
+		return
+	}
+
+	totalPages := (result.Count + perPage - 1) / perPage
+	text := fmt.Sprintf("📍 <b>Маркеры по тегам</b>: %d тегов", result.Count)
+	kb := CreateMarkerTagsKeyboard(result.Tags, page, totalPages)
+
+	if messageID != 0 {
+		b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      chatID,
+			MessageID:   messageID,
+			Text:        text,
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: kb,
+		})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: kb,
+	})
+}
+
+// sendMarker отправляет клип маркера через общий конвейер превью
+func (h *BotHandler) sendMarker(ctx context.Context, b *bot.Bot, chatID int64, marker *SceneMarker) {
+	start := time.Now()
+	log := h.logger.With("user_id", UserIDFromContext(ctx), "chat_id", chatID, "scene_id", marker.Scene.ID, "marker_id", marker.ID)
+	log.Info("Отправка маркера: %s", marker.DisplayTitle())
+
+	kb := h.markerKeyboard(ctx, marker)
+	caption := formatMarkerCaption(marker)
+
+	if err := h.sendPreview(ctx, b, chatID, markerPreviewItem(marker), caption, kb); err != nil {
+		log.With(durationField(start)).Error("Не удалось отправить клип маркера: %v", err)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      chatID,
+			Text:        caption,
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: kb,
+		})
+		return
+	}
+
+	log.With(durationField(start)).Success("Маркер отправлен успешно")
+}
+
+// markerPreviewItem описывает клип маркера
+func markerPreviewItem(marker *SceneMarker) previewItem {
+	return previewItem{
+		key:           "marker_" + marker.ID,
+		previewURL:    marker.Preview,
+		screenshotURL: marker.Screenshot,
+		filename:      marker.DisplayTitle(),
+	}
+}
+
+// formatMarkerCaption формирует HTML подпись маркера. Каждое название не длиннее
+// captionMaxTitle, так что подпись укладывается в captionLimit.
+func formatMarkerCaption(marker *SceneMarker) string {
+	lines := []string{
+		fmt.Sprintf("📍 <b>%s</b>", escapeHTML(truncateUTF16(marker.DisplayTitle(), captionMaxTitle))),
+		fmt.Sprintf("🏷 %s · ⏱ %s", escapeHTML(truncateUTF16(marker.PrimaryTag.Name, captionMaxTitle)), formatDuration(marker.Seconds)),
+		fmt.Sprintf("🎬 %s", escapeHTML(truncateUTF16(marker.Scene.DisplayTitle(), captionMaxTitle))),
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markerListTitle предельная длина названий маркера и сцены в строке списка:
+// даже PER_PAGE строк должны уместиться в 4096 символов сообщения
+const markerListTitle = 30
+
+// writeMarkerList выводит нумерованный список маркеров с временем начала
+func writeMarkerList(sb *strings.Builder, markers []SceneMarker, offset int) {
+	for i := range markers {
+		fmt.Fprintf(sb, "%d. %s <i>(%s, %s)</i>\n",
+			offset+i+1,
+			escapeHTML(truncateUTF16(markers[i].DisplayTitle(), markerListTitle)),
+			escapeHTML(truncateUTF16(markers[i].Scene.DisplayTitle(), markerListTitle)),
+			formatDuration(markers[i].Seconds),
+		)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Метрики Prometheus
+var (
+	updatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stashbot_updates_total",
+		Help: "Обработанные обновления по командам (command:/<команда>) и префиксам callback данных (callback:<префикс>)",
+	}, []string{"kind"})
+
+	updateDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "stashbot_update_duration_seconds",
+		Help:    "Длительность обработки обновления",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"kind"})
+
+	graphQLDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "stashbot_graphql_request_duration_seconds",
+		Help:    "Длительность GraphQL запросов к Stash вместе с повторами",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	graphQLRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stashbot_graphql_retries_total",
+		Help: "Повторные попытки GraphQL запросов к Stash",
+	}, []string{"operation"})
+
+	previewDownloadBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "stashbot_preview_download_bytes",
+		Help:    "Размер загруженных из Stash превью",
+		Buckets: prometheus.ExponentialBuckets(256*1024, 2, 9),
+	})
+
+	previewDownloadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "stashbot_preview_download_duration_seconds",
+		Help:    "Длительность загрузки превью из Stash (вместе с передачей в Telegram при потоковой отправке)",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	})
+
+	previewCacheTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stashbot_preview_cache_total",
+		Help: "Обращения к кэшу file_id превью",
+	}, []string{"result"})
+
+	telegramRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stashbot_telegram_requests_total",
+		Help: "Запросы к Bot API по методам",
+	}, []string{"method"})
+
+	telegramFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stashbot_telegram_failures_total",
+		Help: "Неудачные запросы к Bot API по методам",
+	}, []string{"method"})
+
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stashbot_rate_limited_total",
+		Help: "Запросы, отклоненные из-за превышения лимита, по ролям",
+	}, []string{"role"})
+
+	stashUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "stashbot_stash_up",
+		Help: "Доступность Stash по результату последней проверки (1 - доступен)",
+	})
+
+	stashCircuitState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "stashbot_stash_circuit_state",
+		Help: "Состояние автомата запросов к Stash (0 - запросы идут, 1 - приостановлены, 2 - проверка связи)",
+	})
+)
+
+// MetricsMiddleware считает обновления и время их обработки
+func MetricsMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		start := time.Now()
+		kind := updateKind(update)
+
+		next(ctx, b, update)
+
+		updatesTotal.WithLabelValues(kind).Inc()
+		updateDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeGraphQL записывает длительность и повторы GraphQL запроса
+func observeGraphQL(operation string, start time.Time, attempts int, err error) {
+	status := "ok"
+	var stashErr *StashError
+	switch {
+	case errors.As(err, &stashErr):
+		status = stashErr.Kind.String()
+	case errors.Is(err, context.Canceled):
+		status = "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		status = "timeout"
+	case err != nil:
+		status = "error"
+	}
+	graphQLDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+	if attempts > 1 {
+		graphQLRetries.WithLabelValues(operation).Add(float64(attempts - 1))
+	}
+}
+
+// meteredBody считает размер и длительность загрузки превью до закрытия потока
+type meteredBody struct {
+	io.ReadCloser
+	start time.Time
+	size  int64
+	once  sync.Once
+}
+
+func newMeteredBody(body io.ReadCloser) *meteredBody {
+	return &meteredBody{ReadCloser: body, start: time.Now()}
+}
+
+func (m *meteredBody) Read(p []byte) (int, error) {
+	n, err := m.ReadCloser.Read(p)
+	m.size += int64(n)
+	return n, err
+}
+
+func (m *meteredBody) Close() error {
+	m.once.Do(func() {
+		previewDownloadBytes.Observe(float64(m.size))
+		previewDownloadDuration.Observe(time.Since(m.start).Seconds())
+	})
+	return m.ReadCloser.Close()
+}
+
+// telegramTransport считает запросы к Bot API и их ошибки по методам
+type telegramTransport struct {
+	base http.RoundTripper
+}
+
+func newTelegramTransport() *telegramTransport {
+	return &telegramTransport{base: http.DefaultTransport}
+}
+
+func (t *telegramTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	telegramRequests.WithLabelValues(method).Inc()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		telegramFailures.WithLabelValues(method).Inc()
+	} else if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		telegramFailures.WithLabelValues(method).Inc()
+	}
+	return resp, err
+}
+
+// healthProbeTimeout ограничивает одну проверку Stash для /healthz
+const healthProbeTimeout = 5 * time.Second
+
+// errHealthPending возвращается, пока первая проверка еще не завершилась
+var errHealthPending = errors.New("проверка подключения к Stash еще выполняется")
+
+// HealthChecker проверяет доступность Stash, кэшируя результат, чтобы частые
+// запросы /healthz не нагружали Stash
+type HealthChecker struct {
+	stash *StashClient
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	probing bool
+	checked time.Time
+	lastErr error
+}
+
+func NewHealthChecker(stash *StashClient, ttl time.Duration) *HealthChecker {
+	return &HealthChecker{stash: stash, ttl: ttl}
+}
+
+// Check возвращает результат последней проверки или проверяет Stash заново.
+// Одновременно выполняется только одна проверка; остальные запросы получают
+// прежний результат, не дожидаясь ее.
+func (hc *HealthChecker) Check(ctx context.Context) (time.Time, error) {
+	hc.mu.Lock()
+	if time.Since(hc.checked) < hc.ttl || hc.probing {
+		checked, err := hc.checked, hc.lastErr
+		hc.mu.Unlock()
+		if checked.IsZero() {
+			err = errHealthPending
+		}
+		return checked, err
+	}
+	hc.probing = true
+	hc.mu.Unlock()
+
+	// Пока запросы приостановлены, Stash недоступен и для обработчиков:
+	// связь проверяет WatchAvailability, здесь ее не дергаем
+	var err error
+	if hc.stash.Offline() {
+		err = ErrStashOffline
+	} else {
+		probeCtx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+		err = hc.stash.Probe(probeCtx)
+		cancel()
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.probing = false
+
+	// Прерванная проверка ничего не говорит о Stash - не запоминаем ее
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return time.Now(), err
+	}
+
+	hc.lastErr = err
+	hc.checked = time.Now()
+
+	if hc.lastErr != nil {
+		stashUp.Set(0)
+	} else {
+		stashUp.Set(1)
+	}
+
+	return hc.checked, hc.lastErr
+}
+
+// ServeHTTP отвечает на /healthz
+func (hc *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	checked, err := hc.Check(r.Context())
+
+	status := map[string]string{
+		"status":     "ok",
+		"checked_at": checked.UTC().Format(time.RFC3339),
+	}
+	code := http.StatusOK
+	if err != nil {
+		status["status"] = "unavailable"
+		status["error"] = err.Error()
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// RunMetricsServer отдает /metrics и /healthz и останавливается при отмене контекста
+func RunMetricsServer(ctx context.Context, addr string, health *HealthChecker) error {
+	logger := NewLogger("Metrics")
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", health)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Метрики доступны на %s/metrics", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("ошибка сервера метрик: %w", err)
+	}
+	return nil
+}
@@ -1,5 +1,10 @@
 package main
 
+import (
+	"encoding/json"
+	"path"
+)
+
 // GraphQLRequest StashApp GraphQL структуры
 type GraphQLRequest struct {
 	Query     string                 `json:"query"`
@@ -7,11 +12,25 @@ type GraphQLRequest struct {
 }
 
 type Scene struct {
-	ID    string `json:"id"`
-	Title string `json:"title"`
-	Path  string `json:"path"`
-	Files []struct {
-		Path string `json:"path"`
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Date      string `json:"date"`
+	Details   string `json:"details"`
+	Rating100 *int   `json:"rating100"`
+	OCounter  int    `json:"o_counter"`
+	PlayCount int    `json:"play_count"`
+	Path      string `json:"path"`
+	Files     []struct {
+		Path         string  `json:"path"`
+		Duration     float64 `json:"duration"`
+		Width        int     `json:"width"`
+		Height       int     `json:"height"`
+		Size         int64   `json:"size"`
+		VideoCodec   string  `json:"video_codec"`
+		Fingerprints []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"fingerprints"`
 	} `json:"files"`
 	Paths struct {
 		Screenshot string `json:"screenshot"`
@@ -19,10 +38,10 @@ type Scene struct {
 		Preview    string `json:"preview"`
 		Sprite     string `json:"sprite"`
 	} `json:"paths"`
-	Tags []struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-	} `json:"tags"`
+	Tags         []Tag `json:"tags"`
+	SceneMarkers []struct {
+		ID string `json:"id"`
+	} `json:"scene_markers"`
 	Performers []struct {
 		ID   string `json:"id"`
 		Name string `json:"name"`
@@ -33,15 +52,145 @@ type Scene struct {
 	} `json:"studio"`
 }
 
+// Duration возвращает длительность сцены в секундах по первому файлу
+func (s *Scene) Duration() float64 {
+	if len(s.Files) == 0 {
+		return 0
+	}
+	return s.Files[0].Duration
+}
+
+// PreviewChecksum возвращает отпечаток основного файла сцены (oshash или md5).
+// Это отпечаток исходного видео, а не превью: перегенерацию превью он не отражает.
+func (s *Scene) PreviewChecksum() string {
+	if len(s.Files) == 0 {
+		return ""
+	}
+
+	var checksum string
+	for _, fp := range s.Files[0].Fingerprints {
+		switch fp.Type {
+		case "oshash":
+			return fp.Value
+		case "md5":
+			checksum = fp.Value
+		}
+	}
+	return checksum
+}
+
+// DisplayTitle возвращает название сцены или имя файла, если название не задано
+func (s *Scene) DisplayTitle() string {
+	if s.Title != "" {
+		return s.Title
+	}
+	if len(s.Files) > 0 {
+		return path.Base(s.Files[0].Path)
+	}
+	return "Без названия"
+}
+
+type Performer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Studio struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Tag struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	SceneMarkerCount int    `json:"scene_marker_count"`
+}
+
+// SceneMarker маркер сцены с собственными превью и скриншотом
+type SceneMarker struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	Seconds    float64 `json:"seconds"`
+	Preview    string  `json:"preview"`
+	Stream     string  `json:"stream"`
+	Screenshot string  `json:"screenshot"`
+	PrimaryTag Tag     `json:"primary_tag"`
+	Scene      Scene   `json:"scene"`
+}
+
+// DisplayTitle возвращает название маркера или его основной тег
+func (m *SceneMarker) DisplayTitle() string {
+	if m.Title != "" {
+		return m.Title
+	}
+	return m.PrimaryTag.Name
+}
+
+// GraphQLResponse ответ StashApp; поле data декодируется отдельно для каждой операции
 type GraphQLResponse struct {
-	Data struct {
-		FindScenes struct {
-			Scenes []Scene `json:"scenes"`
-			Count  int     `json:"count"`
-		} `json:"findScenes"`
-		FindScene Scene `json:"findScene"`
-	} `json:"data"`
+	Data   json.RawMessage `json:"data"`
 	Errors []struct {
 		Message string `json:"message"`
 	} `json:"errors"`
 }
+
+// FindFilter параметры выборки (FindFilterType)
+type FindFilter struct {
+	Q         string `json:"q,omitempty"`
+	Page      int    `json:"page,omitempty"`
+	PerPage   int    `json:"per_page,omitempty"`
+	Sort      string `json:"sort,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+// SceneFilter фильтр сцен (SceneFilterType)
+type SceneFilter map[string]interface{}
+
+// SceneUpdateInput изменяемые поля сцены (SceneUpdateInput)
+type SceneUpdateInput struct {
+	ID        string `json:"id"`
+	Rating100 *int   `json:"rating100,omitempty"`
+	// ClearRating сбрасывает оценку: Stash удаляет ее только при явном rating100: null
+	ClearRating bool `json:"-"`
+}
+
+func (in SceneUpdateInput) MarshalJSON() ([]byte, error) {
+	type plain SceneUpdateInput
+	if !in.ClearRating {
+		return json.Marshal(plain(in))
+	}
+	return json.Marshal(struct {
+		plain
+		Rating100 *int `json:"rating100"`
+	}{plain: plain(in)})
+}
+
+// BulkUpdateIDMode способ изменения списка связей сцены (BulkUpdateIdMode)
+type BulkUpdateIDMode string
+
+const (
+	BulkUpdateAdd    BulkUpdateIDMode = "ADD"
+	BulkUpdateRemove BulkUpdateIDMode = "REMOVE"
+)
+
+// BulkUpdateIDs изменение списка связей (BulkUpdateIds): Stash применяет его к
+// текущему списку, поэтому одновременные изменения не перезаписывают друг друга
+type BulkUpdateIDs struct {
+	IDs  []string         `json:"ids"`
+	Mode BulkUpdateIDMode `json:"mode"`
+}
+
+type FindScenesResult struct {
+	Count  int     `json:"count"`
+	Scenes []Scene `json:"scenes"`
+}
+
+type FindSceneMarkersResult struct {
+	Count        int           `json:"count"`
+	SceneMarkers []SceneMarker `json:"scene_markers"`
+}
+
+type FindTagsResult struct {
+	Count int   `json:"count"`
+	Tags  []Tag `json:"tags"`
+}
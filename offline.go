@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"math/rand"
+	"slices"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// recentScenesLimit сколько последних отправленных сцен помнить для работы без Stash
+const recentScenesLimit = 50
+
+// RecentScenes последние успешно полученные из Stash сцены. Пока Stash недоступен,
+// бот показывает их вместо случайного видео.
+type RecentScenes struct {
+	mu     sync.Mutex
+	scenes []Scene
+}
+
+func NewRecentScenes() *RecentScenes {
+	return &RecentScenes{}
+}
+
+// Add запоминает сцену, вытесняя самую старую при переполнении
+func (r *RecentScenes) Add(scene *Scene) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.scenes {
+		if r.scenes[i].ID == scene.ID {
+			r.scenes = append(r.scenes[:i], r.scenes[i+1:]...)
+			break
+		}
+	}
+
+	r.scenes = append(r.scenes, *scene)
+	if len(r.scenes) > recentScenesLimit {
+		r.scenes = r.scenes[len(r.scenes)-recentScenesLimit:]
+	}
+}
+
+// Random возвращает случайную из запомненных сцен, подходящих под match (nil - любые),
+// предпочитая те, превью которых можно отправить по file_id без обращения к Stash
+func (r *RecentScenes) Random(match, cached func(*Scene) bool) (*Scene, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched, withPreview []int
+	for i := range r.scenes {
+		if match != nil && !match(&r.scenes[i]) {
+			continue
+		}
+		matched = append(matched, i)
+		if cached(&r.scenes[i]) {
+			withPreview = append(withPreview, i)
+		}
+	}
+
+	if len(withPreview) > 0 {
+		matched = withPreview
+	}
+	if len(matched) == 0 {
+		return nil, false
+	}
+
+	scene := r.scenes[matched[rand.Intn(len(matched))]]
+	return &scene, true
+}
+
+// replyOffline отвечает, если ошибка означает недоступность Stash: сообщает об этом
+// и показывает одну из недавних сцен, подходящих под match (nil - любую).
+// Возвращает false для прочих ошибок.
+func (h *BotHandler) replyOffline(ctx context.Context, b *bot.Bot, chatID int64, err error, match func(*Scene) bool) bool {
+	if !errors.Is(err, ErrStashOffline) {
+		return false
+	}
+
+	h.sendStashOffline(ctx, b, chatID)
+
+	mode := h.config.Get().PreviewMode
+	scene, ok := h.recent.Random(match, func(scene *Scene) bool {
+		_, _, ok := h.previews.Lookup(scenePreviewItem(scene), mode)
+		return ok
+	})
+	if !ok {
+		return true
+	}
+
+	h.logger.With("chat_id", chatID, "scene_id", scene.ID).Info("Stash недоступен, отправляю сцену из недавних")
+	h.sendOfflineScene(ctx, b, chatID, scene)
+	return true
+}
+
+// replyStashError сообщает в чат об ошибке запроса к Stash: пока Stash недоступен -
+// текстом messages.stash_offline, иначе text с описанием ошибки
+func (h *BotHandler) replyStashError(ctx context.Context, b *bot.Bot, chatID int64, text string, err error) {
+	if errors.Is(err, ErrStashOffline) {
+		h.sendStashOffline(ctx, b, chatID)
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text + userErrorText(err),
+	})
+}
+
+// answerStashError отвечает на нажатие кнопки всплывающим окном с ошибкой запроса к Stash,
+// как replyStashError. Окно не поддерживает HTML и вмещает 200 символов, поэтому
+// текст stash_offline очищается от разметки и обрезается.
+func (h *BotHandler) answerStashError(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery, text string, err error) {
+	if errors.Is(err, ErrStashOffline) {
+		offline := html.UnescapeString(htmlTagPattern.ReplaceAllString(h.config.Get().Messages.StashOffline, ""))
+		h.answerCallback(ctx, b, callback, truncateUTF16(offline, 200), true)
+		return
+	}
+
+	h.answerCallback(ctx, b, callback, text+userErrorText(err), true)
+}
+
+// sendStashOffline сообщает, что Stash недоступен
+func (h *BotHandler) sendStashOffline(ctx context.Context, b *bot.Bot, chatID int64) {
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      h.config.Get().Messages.StashOffline,
+		ParseMode: models.ParseModeHTML,
+	})
+}
+
+// sendOfflineScene отправляет сцену, не обращаясь к Stash: превью только из кэша file_id
+func (h *BotHandler) sendOfflineScene(ctx context.Context, b *bot.Bot, chatID int64, scene *Scene) {
+	mode := h.config.Get().PreviewMode
+	item := scenePreviewItem(scene)
+	kb := h.sceneKeyboard(ctx, scene)
+	caption := formatSceneCaption(scene)
+
+	if fileID, cachedMode, ok := h.previews.Lookup(item, mode); ok {
+		if err := h.sendCachedPreview(ctx, b, chatID, cachedMode, fileID, caption, kb); err == nil {
+			previewCacheTotal.WithLabelValues("hit").Inc()
+			return
+		}
+	}
+
+	h.sendSceneWithoutPreview(ctx, b, chatID, scene)
+}
+
+// browseMatch проверяет, входит ли сцена в подборку, по данным самой сцены.
+// Дочерние теги без Stash неизвестны, поэтому для тега учитывается только он сам.
+func browseMatch(kind, id string) func(*Scene) bool {
+	return func(scene *Scene) bool {
+		switch kind {
+		case "performer":
+			for _, performer := range scene.Performers {
+				if performer.ID == id {
+					return true
+				}
+			}
+			return false
+		case "studio":
+			return scene.Studio.ID == id
+		case "tag":
+			return slices.ContainsFunc(scene.Tags, func(t Tag) bool { return t.ID == id })
+		default:
+			return false
+		}
+	}
+}
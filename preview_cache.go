@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// previewCacheSaveDelay изменения кэша копятся и записываются на диск одним разом
+const previewCacheSaveDelay = 5 * time.Second
+
+// previewCacheEntry запись о загруженном в Telegram превью
+type previewCacheEntry struct {
+	FileID string      `json:"file_id"`
+	Mode   PreviewMode `json:"mode,omitempty"`
+	// Requested способ, которым превью не удалось отправить (Telegram не принял видео),
+	// поэтому оно отправлено документом; повторять заведомо неудачную загрузку не нужно
+	Requested PreviewMode `json:"requested,omitempty"`
+	Checksum  string      `json:"checksum,omitempty"`
+	// Version ETag или Last-Modified превью на момент загрузки
+	Version string `json:"version,omitempty"`
+}
+
+// previewCacheData содержимое файла кэша
+type previewCacheData struct {
+	Scenes    map[string]previewCacheEntry `json:"scenes"`
+	Checksums map[string]string            `json:"checksums"`
+}
+
+// PreviewCache хранит file_id загруженных превью, чтобы не отправлять их повторно
+type PreviewCache struct {
+	path   string
+	logger *Logger
+
+	mu   sync.Mutex
+	data previewCacheData
+	// saveTimer запланированная запись изменений на диск
+	saveTimer *time.Timer
+}
+
+func NewPreviewCache(dataDir string) *PreviewCache {
+	pc := &PreviewCache{
+		path:   filepath.Join(dataDir, "preview_cache.json"),
+		logger: NewLogger("PreviewCache"),
+		data: previewCacheData{
+			Scenes:    make(map[string]previewCacheEntry),
+			Checksums: make(map[string]string),
+		},
+	}
+
+	if err := pc.load(); err != nil {
+		pc.logger.Warning("Не удалось загрузить кэш превью: %v", err)
+	}
+
+	return pc
+}
+
+// Lookup возвращает file_id превью и способ, которым оно было загружено, если ни
+// исходный файл, ни превью не менялись с момента загрузки и превью было отправлено
+// тем же способом (или этим способом его отправить не удалось и оно ушло документом)
+func (pc *PreviewCache) Lookup(item previewItem, mode PreviewMode) (string, PreviewMode, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	checksum := item.checksum
+
+	if entry, ok := pc.data.Scenes[item.key]; ok {
+		// Без версии (не запрашивалась или Stash не ответил) доверяем кэшу,
+		// иначе превью должно совпадать
+		sameVersion := item.version == "" || entry.Version == item.version
+		if entry.Checksum == checksum && sameVersion {
+			if entry.Mode == mode || entry.Requested == mode {
+				return entry.FileID, entry.Mode, true
+			}
+			return "", "", false
+		}
+
+		// Файл или превью изменились в Stash - старое превью больше не годится
+		delete(pc.data.Scenes, item.key)
+		delete(pc.data.Checksums, checksumKey(entry.Mode, entry.Checksum, entry.Version))
+		pc.scheduleSaveLocked()
+		return "", "", false
+	}
+
+	if checksum != "" && item.version != "" {
+		if fileID, ok := pc.data.Checksums[checksumKey(mode, checksum, item.version)]; ok {
+			return fileID, mode, true
+		}
+	}
+
+	return "", "", false
+}
+
+// Store запоминает file_id превью, загруженного способом mode вместо requested
+func (pc *PreviewCache) Store(item previewItem, requested, mode PreviewMode, fileID string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	checksum := item.checksum
+
+	entry := previewCacheEntry{
+		FileID:   fileID,
+		Mode:     mode,
+		Checksum: checksum,
+		Version:  item.version,
+	}
+	if requested != mode {
+		entry.Requested = requested
+	}
+	// Запись о прежней версии превью сцены больше не нужна
+	if old, ok := pc.data.Scenes[item.key]; ok {
+		pc.forgetChecksumLocked(item.key, old)
+	}
+	pc.data.Scenes[item.key] = entry
+	if checksum != "" && item.version != "" {
+		pc.data.Checksums[checksumKey(mode, checksum, item.version)] = fileID
+	}
+
+	pc.scheduleSaveLocked()
+}
+
+// Invalidate удаляет превью из кэша
+func (pc *PreviewCache) Invalidate(item previewItem, mode PreviewMode) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	// Версия берется из записи: при отправке из кэша она могла быть еще неизвестна
+	version := item.version
+	if entry, ok := pc.data.Scenes[item.key]; ok {
+		version = entry.Version
+		delete(pc.data.Scenes, item.key)
+	}
+	if checksum := item.checksum; checksum != "" {
+		delete(pc.data.Checksums, checksumKey(mode, checksum, version))
+	}
+
+	pc.scheduleSaveLocked()
+}
+
+// forgetChecksumLocked удаляет file_id по отпечатку из записи сцены key, если на него
+// не ссылаются другие сцены с тем же файлом; вызывается под pc.mu
+func (pc *PreviewCache) forgetChecksumLocked(key string, entry previewCacheEntry) {
+	if entry.Checksum == "" || entry.Version == "" {
+		return
+	}
+
+	ck := checksumKey(entry.Mode, entry.Checksum, entry.Version)
+	for other, e := range pc.data.Scenes {
+		if other != key && e.Checksum != "" && checksumKey(e.Mode, e.Checksum, e.Version) == ck {
+			return
+		}
+	}
+	delete(pc.data.Checksums, ck)
+}
+
+// checksumKey ключ кэша по отпечатку исходного файла и версии превью:
+// file_id разных типов медиа не взаимозаменяемы
+func checksumKey(mode PreviewMode, checksum, version string) string {
+	key := checksum + "@" + version
+	if mode == PreviewModeDocument {
+		return key
+	}
+	return string(mode) + ":" + key
+}
+
+func (pc *PreviewCache) load() error {
+	raw, err := os.ReadFile(pc.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(raw, &pc.data); err != nil {
+		return fmt.Errorf("ошибка парсинга %s: %w", pc.path, err)
+	}
+
+	if pc.data.Scenes == nil {
+		pc.data.Scenes = make(map[string]previewCacheEntry)
+	}
+	if pc.data.Checksums == nil {
+		pc.data.Checksums = make(map[string]string)
+	}
+
+	// Записи без способа отправки остались от версий, умевших только документы
+	used := make(map[string]bool, len(pc.data.Scenes))
+	for id, entry := range pc.data.Scenes {
+		if entry.Mode == "" {
+			entry.Mode = PreviewModeDocument
+			pc.data.Scenes[id] = entry
+		}
+		used[checksumKey(entry.Mode, entry.Checksum, entry.Version)] = true
+	}
+
+	// Отпечатки устаревших версий превью, накопленные прежними версиями бота
+	for key := range pc.data.Checksums {
+		if !used[key] {
+			delete(pc.data.Checksums, key)
+		}
+	}
+
+	pc.logger.Info("Загружено превью из кэша: %d", len(pc.data.Scenes))
+	return nil
+}
+
+// scheduleSaveLocked планирует запись кэша на диск через previewCacheSaveDelay,
+// чтобы серия изменений записывалась одним разом; вызывается под pc.mu
+func (pc *PreviewCache) scheduleSaveLocked() {
+	if pc.saveTimer != nil {
+		return
+	}
+	pc.saveTimer = time.AfterFunc(previewCacheSaveDelay, pc.Flush)
+}
+
+// Flush записывает на диск запланированные изменения кэша
+func (pc *PreviewCache) Flush() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.saveTimer == nil {
+		return
+	}
+	pc.saveTimer.Stop()
+	pc.saveTimer = nil
+	pc.saveLocked()
+}
+
+// saveLocked атомарно записывает кэш на диск; вызывается под pc.mu
+func (pc *PreviewCache) saveLocked() {
+	raw, err := json.Marshal(pc.data)
+	if err != nil {
+		pc.logger.Error("Ошибка сериализации кэша превью: %v", err)
+		return
+	}
+
+	tmp := pc.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		pc.logger.Error("Ошибка записи кэша превью: %v", err)
+		return
+	}
+
+	if err := os.Rename(tmp, pc.path); err != nil {
+		pc.logger.Error("Ошибка записи кэша превью: %v", err)
+	}
+}
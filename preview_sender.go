@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Ограничения Telegram для миниатюры: не больше 200 КБ и 320 точек по большей стороне
+const (
+	maxThumbnailSize = 200 * 1024
+	maxThumbnailSide = 320
+)
+
+// previewItem описывает превью (сцены или маркера) для отправки в Telegram
+type previewItem struct {
+	// Ключ кэша file_id и признаки изменения в Stash: исходного файла и самого
+	// превью (ETag или Last-Modified, пусто, если неизвестно). Время изменения
+	// сцены не учитывается: оценка, счетчики и теги не меняют превью.
+	key      string
+	checksum string
+	version  string
+
+	previewURL    string
+	screenshotURL string
+	filename      string
+}
+
+// scenePreviewItem описывает превью сцены. Размеры и длительность не передаются:
+// у превью они свои, не как у исходного видео, и Telegram определит их сам.
+func scenePreviewItem(scene *Scene) previewItem {
+	return previewItem{
+		key:           scene.ID,
+		checksum:      scene.PreviewChecksum(),
+		previewURL:    scene.Paths.Preview,
+		screenshotURL: scene.Paths.Screenshot,
+		filename:      scene.DisplayTitle(),
+	}
+}
+
+// sendPreview отправляет превью с подписью и клавиатурой, повторно используя
+// загруженные ранее файлы и переходя на отправку документом при ошибке
+func (h *BotHandler) sendPreview(ctx context.Context, b *bot.Bot, chatID int64, item previewItem, caption string, kb models.ReplyMarkup) error {
+	requested := h.config.Get().PreviewMode
+
+	// Превью сцены с тем же отпечатком файла отправляем из кэша, не обращаясь к Stash.
+	// У клипов маркеров отпечатка нет, и об их изменении говорит только версия превью.
+	if item.checksum == "" {
+		item.version = h.previewVersion(ctx, item)
+	}
+
+	fileID, cachedMode, ok := h.previews.Lookup(item, requested)
+	if !ok && item.version == "" {
+		// Версия нужна для ключа кэша загрузки; она же находит это превью,
+		// загруженное для другой сцены с тем же файлом
+		item.version = h.previewVersion(ctx, item)
+		fileID, cachedMode, ok = h.previews.Lookup(item, requested)
+	}
+
+	// Превью уже загружалось в Telegram - отправляем по file_id
+	if ok {
+		err := h.sendCachedPreview(ctx, b, chatID, cachedMode, fileID, caption, kb)
+		if err == nil {
+			previewCacheTotal.WithLabelValues("hit").Inc()
+			h.logger.Success("Превью отправлено из кэша")
+			return nil
+		}
+
+		previewCacheTotal.WithLabelValues("stale").Inc()
+		h.logger.Warning("Не удалось отправить превью из кэша: %v", err)
+		h.previews.Invalidate(item, cachedMode)
+		if item.version == "" {
+			item.version = h.previewVersion(ctx, item)
+		}
+	} else {
+		previewCacheTotal.WithLabelValues("miss").Inc()
+	}
+
+	mode := requested
+	msg, err := h.uploadPreview(ctx, chatID, item, mode, caption, kb)
+	if err != nil && mode != PreviewModeDocument {
+		h.logger.Warning("Не удалось отправить превью как %s, отправляю документом: %v", mode, err)
+		mode = PreviewModeDocument
+		msg, err = h.uploadPreview(ctx, chatID, item, mode, caption, kb)
+	}
+	if err != nil {
+		return err
+	}
+
+	if fileID := messageFileID(msg); fileID != "" {
+		h.previews.Store(item, requested, mode, fileID)
+	}
+	return nil
+}
+
+// previewVersion возвращает ETag или Last-Modified превью (меняется, когда Stash
+// генерирует его заново). Пока Stash недоступен, не ждем ответа и возвращаем пустую строку.
+func (h *BotHandler) previewVersion(ctx context.Context, item previewItem) string {
+	if h.stash.Offline() {
+		return ""
+	}
+
+	version, err := h.fileManager.FileVersion(ctx, item.previewURL)
+	if err != nil {
+		h.logger.Warning("Не удалось узнать версию превью: %v", err)
+	}
+	return version
+}
+
+// uploadPreview загружает превью в Telegram заданным способом
+func (h *BotHandler) uploadPreview(ctx context.Context, chatID int64, item previewItem, mode PreviewMode, caption string, kb models.ReplyMarkup) (*models.Message, error) {
+	preview, err := h.fileManager.OpenFile(ctx, item.previewURL, item.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer preview.Close()
+
+	fields := map[string]string{
+		"chat_id":      strconv.FormatInt(chatID, 10),
+		"caption":      caption,
+		"parse_mode":   string(models.ParseModeHTML),
+		"reply_markup": replyMarkupField(kb),
+	}
+
+	if mode == PreviewModeDocument {
+		return h.uploader.Upload(ctx, "sendDocument", fields, uploadFile{
+			field:    "document",
+			filename: sanitizeFilename(item.filename) + ".mp4",
+			data:     preview,
+		})
+	}
+
+	files := []uploadFile{{
+		field:    string(mode),
+		filename: sanitizeFilename(item.filename) + ".mp4",
+		data:     preview,
+	}}
+
+	// Скриншот в качестве миниатюры; без него Telegram сгенерирует свою
+	if item.screenshotURL != "" {
+		thumb, err := h.fileManager.FetchSmallFile(ctx, thumbnailURL(item.screenshotURL), maxThumbnailSize)
+		if err != nil {
+			h.logger.Warning("Миниатюра не будет отправлена: %v", err)
+		} else {
+			fields["thumbnail"] = "attach://thumbnail_file"
+			files = append(files, uploadFile{
+				field:    "thumbnail_file",
+				filename: "thumbnail.jpg",
+				data:     bytes.NewReader(thumb),
+			})
+		}
+	}
+
+	method := "sendVideo"
+	if mode == PreviewModeAnimation {
+		method = "sendAnimation"
+	} else {
+		fields["supports_streaming"] = "true"
+	}
+
+	return h.uploader.Upload(ctx, method, fields, files...)
+}
+
+// thumbnailURL просит у Stash уменьшенный скриншот, чтобы он подошел под ограничения миниатюры
+func thumbnailURL(screenshotURL string) string {
+	u, err := url.Parse(screenshotURL)
+	if err != nil {
+		return screenshotURL
+	}
+
+	query := u.Query()
+	query.Set("width", strconv.Itoa(maxThumbnailSide))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// sendCachedPreview отправляет уже загруженное превью по file_id
+func (h *BotHandler) sendCachedPreview(ctx context.Context, b *bot.Bot, chatID int64, mode PreviewMode, fileID, caption string, kb models.ReplyMarkup) error {
+	var err error
+
+	switch mode {
+	case PreviewModeVideo:
+		_, err = b.SendVideo(ctx, &bot.SendVideoParams{
+			ChatID:            chatID,
+			Video:             &models.InputFileString{Data: fileID},
+			Caption:           caption,
+			ParseMode:         models.ParseModeHTML,
+			SupportsStreaming: true,
+			ReplyMarkup:       kb,
+		})
+	case PreviewModeAnimation:
+		_, err = b.SendAnimation(ctx, &bot.SendAnimationParams{
+			ChatID:      chatID,
+			Animation:   &models.InputFileString{Data: fileID},
+			Caption:     caption,
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: kb,
+		})
+	default:
+		_, err = b.SendDocument(ctx, &bot.SendDocumentParams{
+			ChatID:      chatID,
+			Document:    &models.InputFileString{Data: fileID},
+			Caption:     caption,
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: kb,
+		})
+	}
+
+	return err
+}
+
+// messageFileID возвращает file_id медиа из отправленного сообщения
+func messageFileID(msg *models.Message) string {
+	switch {
+	case msg.Animation != nil:
+		return msg.Animation.FileID
+	case msg.Video != nil:
+		return msg.Video.FileID
+	case msg.Document != nil:
+		return msg.Document.FileID
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// rateLimitSweepInterval как часто удалять корзины давно не писавших пользователей
+	rateLimitSweepInterval = 10 * time.Minute
+	// rateLimitWarnInterval не чаще этого напоминать о лимите в ответ на команды
+	rateLimitWarnInterval = 10 * time.Second
+)
+
+// tokenBucket корзина токенов одного пользователя или чата
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	warned  time.Time
+}
+
+// refill пополняет корзину по прошедшему времени, не выше burst
+func (tb *tokenBucket) refill(now time.Time, perMinute, burst int) {
+	if tb.updated.IsZero() {
+		tb.tokens = float64(burst)
+	} else {
+		tb.tokens += now.Sub(tb.updated).Minutes() * float64(perMinute)
+		if tb.tokens > float64(burst) {
+			tb.tokens = float64(burst)
+		}
+	}
+	tb.updated = now
+}
+
+// RateLimiter ограничивает частоту запросов каждого пользователя и каждого чата,
+// чтобы частые нажатия не превращались в поток запросов к Stash и загрузок превью.
+// Лимиты берутся из текущей конфигурации и меняются при ее перезагрузке.
+type RateLimiter struct {
+	store  *ConfigStore
+	logger *Logger
+
+	mu        sync.Mutex
+	users     map[int64]*tokenBucket
+	chats     map[int64]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewRateLimiter(store *ConfigStore) *RateLimiter {
+	return &RateLimiter{
+		store:     store,
+		logger:    NewLogger("RateLimit"),
+		users:     make(map[int64]*tokenBucket),
+		chats:     make(map[int64]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// userLimit лимит запросов в минуту для роли
+func userLimit(config *Config, role Role) int {
+	switch role {
+	case RoleAdmin:
+		return config.RateLimitAdmin
+	case RoleEditor:
+		return config.RateLimitEditor
+	default:
+		return config.RateLimitViewer
+	}
+}
+
+// Allow списывает токен у пользователя и чата. Возвращает false, если лимит исчерпан,
+// и true вторым значением, если пользователю пора напомнить о лимите.
+func (rl *RateLimiter) Allow(role Role, userID, chatID int64) (bool, bool) {
+	config := rl.store.Get()
+	burst := config.RateLimitBurst
+	now := time.Now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	var buckets []*tokenBucket
+	if limit := userLimit(config, role); limit > 0 {
+		user := rl.bucket(rl.users, userID)
+		user.refill(now, limit, burst)
+		buckets = append(buckets, user)
+	}
+	// В личной переписке чат совпадает с пользователем - ограничиваем только группы
+	if limit := config.RateLimitChat; limit > 0 && chatID != 0 && chatID != userID {
+		chat := rl.bucket(rl.chats, chatID)
+		chat.refill(now, limit, burst)
+		buckets = append(buckets, chat)
+	}
+
+	for _, tb := range buckets {
+		if tb.tokens < 1 {
+			warn := now.Sub(buckets[0].warned) >= rateLimitWarnInterval
+			if warn {
+				buckets[0].warned = now
+			}
+			return false, warn
+		}
+	}
+
+	for _, tb := range buckets {
+		tb.tokens--
+	}
+	return true, false
+}
+
+// bucket возвращает корзину по ключу, создавая ее при первом обращении
+func (rl *RateLimiter) bucket(buckets map[int64]*tokenBucket, id int64) *tokenBucket {
+	tb, ok := buckets[id]
+	if !ok {
+		tb = &tokenBucket{}
+		buckets[id] = tb
+	}
+	return tb
+}
+
+// sweep удаляет корзины, которые давно не использовались; вызывается под rl.mu
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+
+	for _, buckets := range []map[int64]*tokenBucket{rl.users, rl.chats} {
+		for id, tb := range buckets {
+			if now.Sub(tb.updated) >= rateLimitSweepInterval {
+				delete(buckets, id)
+			}
+		}
+	}
+}
+
+// Limit пропускает обновление к обработчику, только если лимит не исчерпан
+func (rl *RateLimiter) Limit(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		userID, chatID, ok := updateSource(update)
+		if !ok {
+			next(ctx, b, update)
+			return
+		}
+
+		role := RoleFromContext(ctx)
+		allowed, warn := rl.Allow(role, userID, chatID)
+		if allowed {
+			next(ctx, b, update)
+			return
+		}
+
+		rateLimitedTotal.WithLabelValues(role.String()).Inc()
+		rl.logger.With("user_id", userID, "chat_id", chatID, "update", updateKind(update)).Debug("Запрос отклонен: превышен лимит")
+		rl.throttle(ctx, b, update, warn)
+	}
+}
+
+// throttle просит пользователя не торопиться. На нажатие кнопки Telegram ждет ответ
+// в любом случае, а сообщение в чат отправляется не чаще rateLimitWarnInterval.
+func (rl *RateLimiter) throttle(ctx context.Context, b *bot.Bot, update *models.Update, warn bool) {
+	text := rl.store.Get().Messages.SlowDown
+
+	if update.CallbackQuery != nil {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			Text:            text,
+		})
+		return
+	}
+
+	if warn && update.Message != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   text,
+		})
+	}
+}
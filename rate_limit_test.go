@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketRefill(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"partial refill", 0, 3 * time.Second, 1},
+		{"capped at burst", 0, time.Minute, 5},
+		{"no time passed", 2, 0, 2},
+		{"adds to remaining", 1.5, 6 * time.Second, 3.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := &tokenBucket{tokens: tt.tokens, updated: start}
+			tb.refill(start.Add(tt.elapsed), 20, 5)
+			if tb.tokens != tt.want {
+				t.Fatalf("tokens = %v, want %v", tb.tokens, tt.want)
+			}
+		})
+	}
+
+	t.Run("new bucket starts full", func(t *testing.T) {
+		tb := &tokenBucket{}
+		tb.refill(start, 20, 5)
+		if tb.tokens != 5 {
+			t.Fatalf("tokens = %v, want 5", tb.tokens)
+		}
+	})
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	config := defaultConfig()
+	config.RateLimitViewer = 1
+	config.RateLimitAdmin = 0
+	config.RateLimitChat = 0
+	config.RateLimitBurst = 2
+	rl := NewRateLimiter(NewConfigStore(config))
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := rl.Allow(RoleViewer, 1, 1); !ok {
+			t.Fatalf("request %d rejected within burst", i+1)
+		}
+	}
+	ok, warn := rl.Allow(RoleViewer, 1, 1)
+	if ok || !warn {
+		t.Fatalf("Allow() = %v, %v after burst, want false, true", ok, warn)
+	}
+	if _, warn := rl.Allow(RoleViewer, 1, 1); warn {
+		t.Fatal("Allow() warned twice within the warn interval")
+	}
+
+	if ok, _ := rl.Allow(RoleViewer, 2, 2); !ok {
+		t.Fatal("another user shares the bucket")
+	}
+	for i := 0; i < 10; i++ {
+		if ok, _ := rl.Allow(RoleAdmin, 3, 3); !ok {
+			t.Fatal("admin without limit rejected")
+		}
+	}
+}
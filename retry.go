@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StashErrorKind класс ошибки обращения к Stash
+type StashErrorKind int
+
+const (
+	// StashErrNetwork сеть недоступна, соединение оборвалось или истек таймаут
+	StashErrNetwork StashErrorKind = iota
+	// StashErrServer Stash ответил статусом 5xx
+	StashErrServer
+	// StashErrRateLimited Stash (или прокси перед ним) ответил 429
+	StashErrRateLimited
+	// StashErrAuth неверный или отсутствующий ключ API (401/403)
+	StashErrAuth
+	// StashErrRequest прочие ответы 4xx - запрос некорректен
+	StashErrRequest
+	// StashErrGraphQL запрос выполнен, но GraphQL вернул ошибку
+	StashErrGraphQL
+	// StashErrResponse ответ не удалось разобрать
+	StashErrResponse
+	// StashErrOffline запрос не отправлялся: Stash недавно был недоступен
+	StashErrOffline
+)
+
+func (k StashErrorKind) String() string {
+	switch k {
+	case StashErrNetwork:
+		return "network"
+	case StashErrServer:
+		return "server"
+	case StashErrRateLimited:
+		return "rate_limited"
+	case StashErrAuth:
+		return "auth"
+	case StashErrRequest:
+		return "request"
+	case StashErrGraphQL:
+		return "graphql"
+	case StashErrOffline:
+		return "offline"
+	default:
+		return "response"
+	}
+}
+
+// StashError типизированная ошибка запроса к Stash
+type StashError struct {
+	Kind       StashErrorKind
+	StatusCode int
+	// RetryAfter пауза, которую попросил сервер в заголовке Retry-After
+	RetryAfter time.Duration
+	// NotSent запрос гарантированно не дошел до Stash (не удалось установить соединение)
+	NotSent bool
+	Err     error
+}
+
+func (e *StashError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("stash %s (статус %d): %v", e.Kind, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("stash %s: %v", e.Kind, e.Err)
+}
+
+func (e *StashError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable сообщает, может ли повтор запроса закончиться успехом
+func (e *StashError) Retryable() bool {
+	switch e.Kind {
+	case StashErrNetwork, StashErrServer, StashErrRateLimited:
+		return true
+	default:
+		return false
+	}
+}
+
+// statusError классифицирует ответ Stash с кодом, отличным от 200
+func statusError(resp *http.Response, body []byte) *StashError {
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	err := &StashError{
+		StatusCode: resp.StatusCode,
+		Err:        errors.New(truncateString(message, 200)),
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		err.Kind = StashErrRateLimited
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		err.Kind = StashErrAuth
+	case resp.StatusCode >= http.StatusInternalServerError:
+		err.Kind = StashErrServer
+	default:
+		err.Kind = StashErrRequest
+	}
+	return err
+}
+
+// networkError классифицирует ошибку соединения. Ошибки установки соединения
+// (адрес не найден, соединение отклонено) означают, что запрос не был отправлен.
+func networkError(err error) *StashError {
+	var (
+		opErr  *net.OpError
+		dnsErr *net.DNSError
+	)
+	notSent := errors.As(err, &dnsErr) || (errors.As(err, &opErr) && opErr.Op == "dial")
+	return &StashError{Kind: StashErrNetwork, NotSent: notSent, Err: err}
+}
+
+// parseRetryAfter разбирает Retry-After в секундах или в виде даты
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// RetryPolicy решает, повторять ли запрос, и сколько ждать перед повтором
+type RetryPolicy struct {
+	// Attempts общее число попыток, включая первую
+	Attempts int
+	// BaseDelay пауза перед первым повтором, дальше удваивается
+	BaseDelay time.Duration
+	// MaxDelay верхняя граница паузы
+	MaxDelay time.Duration
+}
+
+func NewRetryPolicy(config Config) RetryPolicy {
+	return RetryPolicy{
+		Attempts:  config.StashRetries,
+		BaseDelay: config.StashRetryDelay,
+		MaxDelay:  config.StashRetryMaxDelay,
+	}
+}
+
+// Next возвращает паузу перед следующей попыткой после неудачной попытки attempt (с 1)
+// и false, если повторять не нужно. Изменяющие запросы (mutation) после сетевой ошибки
+// или ответа 5xx повторяются, только если запрос точно не дошел до Stash: иначе
+// изменение, например +1 к счетчику, могло уже примениться и повтор применит его дважды.
+func (p RetryPolicy) Next(attempt int, err error, mutation bool) (time.Duration, bool) {
+	if attempt >= p.Attempts {
+		return 0, false
+	}
+
+	var stashErr *StashError
+	if !errors.As(err, &stashErr) || !stashErr.Retryable() {
+		return 0, false
+	}
+	if mutation && stashErr.Kind != StashErrRateLimited && !stashErr.NotSent {
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+	if stashErr.RetryAfter > delay {
+		delay = stashErr.RetryAfter
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay, true
+}
+
+// backoff экспоненциальная пауза с разбросом: половина фиксирована, половина случайна,
+// чтобы повторы разных пользователей не приходили в Stash одновременно
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// userErrorText переводит ошибку запроса к Stash в понятное пользователю сообщение.
+// Прочие ошибки клиента ("видео не найдено") уже написаны для пользователя.
+func userErrorText(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var stashErr *StashError
+	if !errors.As(err, &stashErr) {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return "запрос прерван, попробуйте еще раз"
+		}
+		return err.Error()
+	}
+
+	switch stashErr.Kind {
+	case StashErrNetwork, StashErrOffline:
+		return "библиотека Stash недоступна, попробуйте позже"
+	case StashErrServer:
+		return "Stash не смог обработать запрос, попробуйте позже"
+	case StashErrRateLimited:
+		return "Stash перегружен запросами, подождите немного"
+	case StashErrAuth:
+		return "бот не может авторизоваться в Stash, сообщите администратору"
+	case StashErrGraphQL, StashErrRequest:
+		return "Stash отклонил запрос"
+	default:
+		return "Stash вернул непонятный ответ"
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyNext(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	network := &StashError{Kind: StashErrNetwork, Err: errors.New("reset")}
+	notSent := &StashError{Kind: StashErrNetwork, NotSent: true, Err: errors.New("refused")}
+	server := &StashError{Kind: StashErrServer, StatusCode: 502, Err: errors.New("bad gateway")}
+	limited := &StashError{Kind: StashErrRateLimited, StatusCode: 429, RetryAfter: 5 * time.Second, Err: errors.New("slow down")}
+	limitedLong := &StashError{Kind: StashErrRateLimited, StatusCode: 429, RetryAfter: time.Minute, Err: errors.New("slow down")}
+	graphql := &StashError{Kind: StashErrGraphQL, Err: errors.New("bad query")}
+
+	tests := []struct {
+		name      string
+		attempt   int
+		err       error
+		mutation  bool
+		wantRetry bool
+		minDelay  time.Duration
+		maxDelay  time.Duration
+	}{
+		{"network query", 1, network, false, true, 500 * time.Millisecond, time.Second},
+		{"server query backs off", 2, server, false, true, time.Second, 2 * time.Second},
+		{"attempts exhausted", 3, network, false, false, 0, 0},
+		{"graphql error", 1, graphql, false, false, 0, 0},
+		{"plain error", 1, errors.New("видео не найдено"), false, false, 0, 0},
+		{"mutation may have been applied", 1, network, true, false, 0, 0},
+		{"mutation after 5xx", 1, server, true, false, 0, 0},
+		{"mutation not sent", 1, notSent, true, true, 500 * time.Millisecond, time.Second},
+		{"mutation rate limited", 1, limited, true, true, 5 * time.Second, 5 * time.Second},
+		{"retry-after capped", 1, limitedLong, false, true, 10 * time.Second, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := policy.Next(tt.attempt, tt.err, tt.mutation)
+			if retry != tt.wantRetry {
+				t.Fatalf("Next() retry = %v, want %v", retry, tt.wantRetry)
+			}
+			if delay < tt.minDelay || delay > tt.maxDelay {
+				t.Fatalf("Next() delay = %s, want between %s and %s", delay, tt.minDelay, tt.maxDelay)
+			}
+		})
+	}
+}
+
+func TestUserErrorText(t *testing.T) {
+	if got := userErrorText(nil); got != "" {
+		t.Fatalf("userErrorText(nil) = %q, want empty", got)
+	}
+	if got := userErrorText(ErrStashOffline); got != "библиотека Stash недоступна, попробуйте позже" {
+		t.Fatalf("userErrorText(ErrStashOffline) = %q", got)
+	}
+	if got := userErrorText(errors.New("видео не найдено")); got != "видео не найдено" {
+		t.Fatalf("userErrorText() = %q, want message unchanged", got)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// HandleSearch обработчик команды /search
+func (h *BotHandler) HandleSearch(ctx context.Context, b *bot.Bot, update *models.Update) {
+	_, q, _ := parseCommand(update.Message.Text)
+	if q == "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    update.Message.Chat.ID,
+			Text:      "🔍 Укажите запрос: <code>/search название</code>\n\nИли просто отправьте текст сообщением.",
+			ParseMode: models.ParseModeHTML,
+		})
+		return
+	}
+
+	h.startSearch(ctx, b, update.Message.Chat.ID, q)
+}
+
+// Ограничения для кнопок страниц поиска
+const (
+	// callbackDataLimit максимальный размер callback данных кнопки в Telegram (байт)
+	callbackDataLimit = 64
+	// searchQueriesLimit сколько длинных запросов помнить для переключения страниц
+	searchQueriesLimit = 500
+)
+
+// searchQuery длинный запрос и чат, в котором он был задан
+type searchQuery struct {
+	chatID int64
+	q      string
+}
+
+// searchQueries хранит поисковые запросы для кнопок страниц. Короткий запрос
+// записывается прямо в callback данные и переживает перезапуск бота; длинный
+// запоминается под случайной ссылкой, привязанной к чату, и помнятся только
+// последние searchQueriesLimit запросов. Случайная ссылка не совпадет с ссылкой
+// до перезапуска, а чужой чат не получит по ней запрос и результаты.
+type searchQueries struct {
+	mu    sync.Mutex
+	order []string
+	byRef map[string]searchQuery
+}
+
+func newSearchQueries() *searchQueries {
+	return &searchQueries{byRef: make(map[string]searchQuery)}
+}
+
+// ref возвращает ссылку на запрос чата для callback данных кнопок страниц
+func (s *searchQueries) ref(chatID int64, q string) string {
+	// search_=<запрос>_<страница>: оставляем место под номер страницы
+	if len("search_=_")+len(q)+4 <= callbackDataLimit {
+		return "=" + q
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ref string
+	for ref == "" || s.byRef[ref] != (searchQuery{}) {
+		ref = "#" + randomRef()
+	}
+	s.byRef[ref] = searchQuery{chatID: chatID, q: q}
+	s.order = append(s.order, ref)
+	if len(s.order) > searchQueriesLimit {
+		delete(s.byRef, s.order[0])
+		s.order = s.order[1:]
+	}
+	return ref
+}
+
+// query возвращает запрос по ссылке из callback данных, если ссылка выдана этому чату
+func (s *searchQueries) query(chatID int64, ref string) (string, bool) {
+	if q, ok := strings.CutPrefix(ref, "="); ok {
+		return q, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.byRef[ref]
+	if !ok || stored.chatID != chatID {
+		return "", false
+	}
+	return stored.q, true
+}
+
+// randomRef случайный идентификатор запроса для callback данных
+func randomRef() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// startSearch отправляет первую страницу результатов поиска
+func (h *BotHandler) startSearch(ctx context.Context, b *bot.Bot, chatID int64, q string) {
+	h.logger.Info("Поиск в чате %d: %q", chatID, q)
+
+	text, kb, err := h.searchPage(ctx, q, h.searches.ref(chatID, q), 1)
+	if err != nil {
+		h.logger.Error("Ошибка поиска: %v", err)
+		h.replyStashError(ctx, b, chatID, "❌ Ошибка поиска: ", err)
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: kb,
+	})
+}
+
+// handleSearchPageCallback переключает страницу результатов поиска (search_<запрос>_<страница>)
+func (h *BotHandler) handleSearchPageCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	msg := callback.Message.Message
+	if msg == nil {
+		return
+	}
+
+	data := strings.TrimPrefix(callback.Data, "search_")
+	sep := strings.LastIndex(data, "_")
+	if sep < 0 {
+		return
+	}
+	ref := data[:sep]
+
+	page, err := strconv.Atoi(data[sep+1:])
+	if err != nil || page < 1 {
+		return
+	}
+
+	q, ok := h.searches.query(msg.Chat.ID, ref)
+	if !ok {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: msg.Chat.ID,
+			Text:   "⌛ Результаты поиска устарели, повторите запрос",
+		})
+		return
+	}
+
+	text, kb, err := h.searchPage(ctx, q, ref, page)
+	if err != nil {
+		h.logger.Error("Ошибка поиска: %v", err)
+		h.replyStashError(ctx, b, msg.Chat.ID, "❌ Ошибка поиска: ", err)
+		return
+	}
+
+	b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.ID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: kb,
+	})
+}
+
+// handleSceneCallback отправляет выбранную из списка сцену
+func (h *BotHandler) handleSceneCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	sceneID := strings.TrimPrefix(callback.Data, "scene_")
+	chatID := callback.Message.Message.Chat.ID
+
+	scene, err := h.stash.FindScene(ctx, sceneID)
+	if err != nil {
+		h.logger.Error("Ошибка получения сцены %s: %v", sceneID, err)
+		h.replyStashError(ctx, b, chatID, "❌ Ошибка: ", err)
+		return
+	}
+
+	h.sendScene(ctx, b, chatID, scene)
+}
+
+// searchPage формирует текст и клавиатуру для страницы результатов поиска
+func (h *BotHandler) searchPage(ctx context.Context, q, ref string, page int) (string, models.ReplyMarkup, error) {
+	perPage := h.config.Get().PerPage
+
+	result, err := h.stash.FindSceneList(ctx, FindFilter{Q: q, Page: page, PerPage: perPage}, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if result.Count == 0 {
+		return fmt.Sprintf("🔍 По запросу <b>%s</b> ничего не найдено", escapeHTML(q)), nil, nil
+	}
+
+	totalPages := (result.Count + perPage - 1) / perPage
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔍 Результаты поиска <b>%s</b>: %d\n\n", escapeHTML(q), result.Count)
+	writeSceneList(&sb, result.Scenes, (page-1)*perPage)
+
+	return sb.String(), CreateSearchKeyboard(result.Scenes, ref, page, totalPages), nil
+}
@@ -2,25 +2,33 @@ package main
 
 import (
 	"bytes"
+	"context"
 	crand "crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// breakerProbeTimeout ограничивает проверку связи, пока запросы приостановлены
+const breakerProbeTimeout = 15 * time.Second
+
 // StashClient клиент для работы со StashApp API
 type StashClient struct {
 	baseURL string
 	apiKey  string
+	retry   RetryPolicy
+	breaker *CircuitBreaker
 	client  *http.Client
 	logger  *Logger
 }
 
-func NewStashClient(baseURL, apiKey string) *StashClient {
+func NewStashClient(config Config) *StashClient {
 	transport := &http.Transport{
 		MaxIdleConns:        10,
 		IdleConnTimeout:     90 * time.Second,
@@ -30,17 +38,33 @@ func NewStashClient(baseURL, apiKey string) *StashClient {
 	}
 
 	return &StashClient{
-		baseURL: baseURL,
-		apiKey:  apiKey,
+		baseURL: config.StashURL,
+		apiKey:  config.StashAPIKey,
+		retry:   NewRetryPolicy(config),
+		breaker: NewCircuitBreaker(config.StashBreakerThreshold, config.StashBreakerCooldown),
 		client: &http.Client{
-			Timeout:   60 * time.Second,
+			Timeout:   config.StashTimeout,
 			Transport: transport,
 		},
 		logger: NewLogger("StashClient"),
 	}
 }
 
-func (s *StashClient) graphQLRequest(query string, variables map[string]interface{}) (*GraphQLResponse, error) {
+// graphQLRequest выполняет запрос и возвращает содержимое поля data.
+// Пока Stash недоступен, запрос сразу завершается ошибкой ErrStashOffline.
+func (s *StashClient) graphQLRequest(ctx context.Context, query string, variables map[string]interface{}) (json.RawMessage, error) {
+	if err := s.breaker.Allow(); err != nil {
+		observeGraphQL(operationName(query), time.Now(), 1, err)
+		return nil, err
+	}
+
+	data, err := s.request(ctx, query, variables)
+	s.breaker.Record(err)
+	return data, err
+}
+
+// request выполняет запрос с повторами согласно политике повторов
+func (s *StashClient) request(ctx context.Context, query string, variables map[string]interface{}) (_ json.RawMessage, err error) {
 	reqBody := GraphQLRequest{
 		Query:     query,
 		Variables: variables,
@@ -51,59 +75,120 @@ func (s *StashClient) graphQLRequest(query string, variables map[string]interfac
 		return nil, fmt.Errorf("ошибка маршалинга запроса: %v", err)
 	}
 
-	var lastErr error
-	for attempt := 0; attempt < 3; attempt++ {
-		if attempt > 0 {
-			time.Sleep(time.Duration(attempt*2) * time.Second)
-			s.logger.Warning("Попытка подключения #%d к StashApp...", attempt+1)
-		}
+	start := time.Now()
+	operation := operationName(query)
+	mutation := strings.HasPrefix(strings.TrimSpace(query), "mutation")
+	log := s.logger.With("operation", operation)
 
-		req, err := http.NewRequest("POST", s.baseURL+"/graphql", bytes.NewBuffer(jsonBody))
-		if err != nil {
-			lastErr = fmt.Errorf("ошибка создания запроса: %v", err)
-			continue
-		}
+	attempt := 0
+	// Учитываем запрос при любом завершении, включая отмену и таймаут вызывающего
+	defer func() { observeGraphQL(operation, start, attempt, err) }()
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Accept", "application/json")
-		if s.apiKey != "" {
-			req.Header.Set("ApiKey", s.apiKey)
+	for {
+		attempt++
+		data, reqErr := s.doGraphQL(ctx, jsonBody)
+		if reqErr == nil {
+			log.With("attempts", attempt, durationField(start)).Debug("GraphQL запрос выполнен")
+			return data, nil
 		}
 
-		resp, err := s.client.Do(req)
-		if err != nil {
-			lastErr = fmt.Errorf("ошибка выполнения запроса (попытка %d): %v", attempt+1, err)
-			continue
+		// Запрос отменен вызывающим - повторять бессмысленно
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			lastErr = fmt.Errorf("ошибка чтения ответа: %v", err)
-			continue
+		delay, retry := s.retry.Next(attempt, reqErr, mutation)
+		if !retry {
+			log.With("attempts", attempt, durationField(start)).Warning("GraphQL запрос не выполнен: %v", reqErr)
+			return nil, reqErr
 		}
 
-		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("сервер вернул статус %d: %s", resp.StatusCode, string(body))
-			continue
+		log.With("attempt", attempt, "delay", delay).Warning("Ошибка запроса к StashApp, повтор: %v", reqErr)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
 		}
+	}
+}
 
-		var result GraphQLResponse
-		err = json.Unmarshal(body, &result)
-		if err != nil {
-			lastErr = fmt.Errorf("ошибка парсинга ответа: %v", err)
-			continue
-		}
+// doGraphQL выполняет одну попытку запроса и классифицирует ошибку
+func (s *StashClient) doGraphQL(ctx context.Context, jsonBody []byte) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/graphql", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %v", err)
+	}
 
-		if len(result.Errors) > 0 {
-			lastErr = fmt.Errorf("GraphQL ошибка: %s", result.Errors[0].Message)
-			continue
-		}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("ApiKey", s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, networkError(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &StashError{Kind: StashErrNetwork, StatusCode: resp.StatusCode, Err: fmt.Errorf("ошибка чтения ответа: %w", err)}
+	}
 
-		return &result, nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp, body)
 	}
 
-	return nil, fmt.Errorf("не удалось подключиться после 3 попыток: %v", lastErr)
+	var result GraphQLResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, &StashError{Kind: StashErrResponse, Err: fmt.Errorf("ошибка парсинга ответа: %w", err)}
+	}
+
+	if len(result.Errors) > 0 {
+		return nil, &StashError{Kind: StashErrGraphQL, Err: errors.New(result.Errors[0].Message)}
+	}
+
+	return result.Data, nil
+}
+
+// sleepContext ждет заданное время или отмены контекста
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// operationName возвращает имя GraphQL операции для логов
+func operationName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) < 2 || (fields[0] != "query" && fields[0] != "mutation") {
+		return "anonymous"
+	}
+	name, _, _ := strings.Cut(fields[1], "(")
+	if name == "" || strings.HasPrefix(name, "{") {
+		return "anonymous"
+	}
+	return name
+}
+
+// execute выполняет операцию и декодирует ее результат в тип T
+func execute[T any](ctx context.Context, s *StashClient, query string, variables map[string]interface{}) (*T, error) {
+	data, err := s.graphQLRequest(ctx, query, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	var result T
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга ответа: %v", err)
+	}
+
+	return &result, nil
 }
 
 // cryptoIntn возвращает равномерное случайное число в [0, n) без модульного смещения.
@@ -119,22 +204,295 @@ func cryptoIntn(n int) (int, error) {
 	return int(v.Int64()), nil
 }
 
-func (s *StashClient) GetRandomScene() (*Scene, error) {
-	s.logger.Info("Получение случайной сцены")
+// FindScenes получает страницу сцен, подходящих под фильтры
+func (s *StashClient) FindScenes(ctx context.Context, filter FindFilter, sceneFilter SceneFilter) (*FindScenesResult, error) {
+	variables := map[string]interface{}{
+		"filter": filter,
+	}
+	if sceneFilter != nil {
+		variables["sceneFilter"] = sceneFilter
+	}
 
-	countQuery := `
-		query {
-			findScenes {
-				count
-			}
-		}`
+	resp, err := execute[struct {
+		FindScenes FindScenesResult `json:"findScenes"`
+	}](ctx, s, findScenesQuery, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp.FindScenes, nil
+}
+
+// FindSceneList получает страницу сцен для списка: только поля sceneListFragment
+func (s *StashClient) FindSceneList(ctx context.Context, filter FindFilter, sceneFilter SceneFilter) (*FindScenesResult, error) {
+	variables := map[string]interface{}{
+		"filter": filter,
+	}
+	if sceneFilter != nil {
+		variables["sceneFilter"] = sceneFilter
+	}
+
+	resp, err := execute[struct {
+		FindScenes FindScenesResult `json:"findScenes"`
+	}](ctx, s, findSceneListQuery, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp.FindScenes, nil
+}
+
+// CountScenes возвращает количество сцен, подходящих под фильтр
+func (s *StashClient) CountScenes(ctx context.Context, sceneFilter SceneFilter) (int, error) {
+	variables := map[string]interface{}{}
+	if sceneFilter != nil {
+		variables["sceneFilter"] = sceneFilter
+	}
+
+	resp, err := execute[struct {
+		FindScenes struct {
+			Count int `json:"count"`
+		} `json:"findScenes"`
+	}](ctx, s, countScenesQuery, variables)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.FindScenes.Count, nil
+}
+
+// FindScene получает сцену по идентификатору
+func (s *StashClient) FindScene(ctx context.Context, id string) (*Scene, error) {
+	s.logger.Info("Получение сцены: %s", id)
+
+	resp, err := execute[struct {
+		FindScene *Scene `json:"findScene"`
+	}](ctx, s, findSceneQuery, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.FindScene == nil {
+		return nil, fmt.Errorf("видео не найдено")
+	}
+
+	return resp.FindScene, nil
+}
+
+// SceneMarkers получает маркеры сцены
+func (s *StashClient) SceneMarkers(ctx context.Context, sceneID string) ([]SceneMarker, error) {
+	resp, err := execute[struct {
+		FindScene *struct {
+			SceneMarkers []SceneMarker `json:"scene_markers"`
+		} `json:"findScene"`
+	}](ctx, s, sceneMarkersQuery, map[string]interface{}{"id": sceneID})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.FindScene == nil {
+		return nil, fmt.Errorf("видео не найдено")
+	}
+
+	return resp.FindScene.SceneMarkers, nil
+}
+
+// FindSceneMarkersByTag получает страницу маркеров с заданным тегом
+func (s *StashClient) FindSceneMarkersByTag(ctx context.Context, tagID string, filter FindFilter) (*FindSceneMarkersResult, error) {
+	variables := map[string]interface{}{
+		"filter": filter,
+		"markerFilter": map[string]interface{}{
+			"tags": map[string]interface{}{
+				"value":    []string{tagID},
+				"modifier": "INCLUDES",
+			},
+		},
+	}
+
+	resp, err := execute[struct {
+		FindSceneMarkers FindSceneMarkersResult `json:"findSceneMarkers"`
+	}](ctx, s, findSceneMarkersQuery, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp.FindSceneMarkers, nil
+}
+
+// FindMarkerTags получает теги, у которых есть маркеры
+func (s *StashClient) FindMarkerTags(ctx context.Context, filter FindFilter) (*FindTagsResult, error) {
+	resp, err := execute[struct {
+		FindTags FindTagsResult `json:"findTags"`
+	}](ctx, s, findMarkerTagsQuery, map[string]interface{}{"filter": filter})
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp.FindTags, nil
+}
+
+// FindPerformer получает исполнителя по идентификатору
+func (s *StashClient) FindPerformer(ctx context.Context, id string) (*Performer, error) {
+	resp, err := execute[struct {
+		FindPerformer *Performer `json:"findPerformer"`
+	}](ctx, s, findPerformerQuery, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.FindPerformer == nil {
+		return nil, fmt.Errorf("исполнитель не найден")
+	}
+
+	return resp.FindPerformer, nil
+}
+
+// FindStudio получает студию по идентификатору
+func (s *StashClient) FindStudio(ctx context.Context, id string) (*Studio, error) {
+	resp, err := execute[struct {
+		FindStudio *Studio `json:"findStudio"`
+	}](ctx, s, findStudioQuery, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.FindStudio == nil {
+		return nil, fmt.Errorf("студия не найдена")
+	}
+
+	return resp.FindStudio, nil
+}
+
+// FindTag получает тег по идентификатору
+func (s *StashClient) FindTag(ctx context.Context, id string) (*Tag, error) {
+	resp, err := execute[struct {
+		FindTag *Tag `json:"findTag"`
+	}](ctx, s, findTagQuery, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.FindTag == nil {
+		return nil, fmt.Errorf("тег не найден")
+	}
+
+	return resp.FindTag, nil
+}
+
+// FindTags ищет теги
+func (s *StashClient) FindTags(ctx context.Context, filter FindFilter) (*FindTagsResult, error) {
+	resp, err := execute[struct {
+		FindTags FindTagsResult `json:"findTags"`
+	}](ctx, s, findTagsQuery, map[string]interface{}{"filter": filter})
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp.FindTags, nil
+}
+
+// UpdateScene изменяет сцену и возвращает ее обновленную версию
+func (s *StashClient) UpdateScene(ctx context.Context, input SceneUpdateInput) (*Scene, error) {
+	s.logger.Info("Изменение сцены: %s", input.ID)
+
+	resp, err := execute[struct {
+		SceneUpdate *Scene `json:"sceneUpdate"`
+	}](ctx, s, sceneUpdateMutation, map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.SceneUpdate == nil {
+		return nil, fmt.Errorf("видео не найдено")
+	}
+
+	return resp.SceneUpdate, nil
+}
+
+// UpdateSceneTags добавляет теги сцене или удаляет их и возвращает обновленную сцену
+func (s *StashClient) UpdateSceneTags(ctx context.Context, id string, mode BulkUpdateIDMode, tagIDs ...string) (*Scene, error) {
+	s.logger.Info("Изменение тегов сцены: %s", id)
+
+	resp, err := execute[struct {
+		Scenes []Scene `json:"bulkSceneUpdate"`
+	}](ctx, s, bulkSceneUpdateMutation, map[string]interface{}{
+		"input": map[string]interface{}{
+			"ids":     []string{id},
+			"tag_ids": BulkUpdateIDs{IDs: tagIDs, Mode: mode},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Scenes) == 0 {
+		return nil, fmt.Errorf("видео не найдено")
+	}
 
-	countResp, err := s.graphQLRequest(countQuery, nil)
+	return &resp.Scenes[0], nil
+}
+
+// IncrementO увеличивает O-счетчик сцены и возвращает новое значение
+func (s *StashClient) IncrementO(ctx context.Context, id string) (int, error) {
+	resp, err := execute[struct {
+		Count int `json:"sceneIncrementO"`
+	}](ctx, s, sceneIncrementOMutation, map[string]interface{}{"id": id})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// DecrementO уменьшает O-счетчик сцены и возвращает новое значение
+func (s *StashClient) DecrementO(ctx context.Context, id string) (int, error) {
+	resp, err := execute[struct {
+		Count int `json:"sceneDecrementO"`
+	}](ctx, s, sceneDecrementOMutation, map[string]interface{}{"id": id})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// AddPlay добавляет просмотр сцены и возвращает новое количество просмотров
+func (s *StashClient) AddPlay(ctx context.Context, id string) (int, error) {
+	resp, err := execute[struct {
+		Result struct {
+			Count int `json:"count"`
+		} `json:"sceneAddPlay"`
+	}](ctx, s, sceneAddPlayMutation, map[string]interface{}{"id": id})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Result.Count, nil
+}
+
+// DeletePlay отменяет последний просмотр сцены и возвращает новое количество просмотров
+func (s *StashClient) DeletePlay(ctx context.Context, id string) (int, error) {
+	resp, err := execute[struct {
+		Result struct {
+			Count int `json:"count"`
+		} `json:"sceneDeletePlay"`
+	}](ctx, s, sceneDeletePlayMutation, map[string]interface{}{"id": id})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Result.Count, nil
+}
+
+// GetRandomScene выбирает случайную сцену из всей библиотеки
+func (s *StashClient) GetRandomScene(ctx context.Context) (*Scene, error) {
+	s.logger.Info("Получение случайной сцены")
+	return s.GetRandomSceneByFilter(ctx, nil)
+}
+
+// GetRandomSceneByFilter выбирает случайную сцену среди подходящих под фильтр
+func (s *StashClient) GetRandomSceneByFilter(ctx context.Context, sceneFilter SceneFilter) (*Scene, error) {
+	count, err := s.CountScenes(ctx, sceneFilter)
 	if err != nil {
 		return nil, err
 	}
 
-	count := countResp.Data.FindScenes.Count
 	if count == 0 {
 		return nil, fmt.Errorf("нет доступных видео")
 	}
@@ -146,53 +504,79 @@ func (s *StashClient) GetRandomScene() (*Scene, error) {
 		randomIndex = rand.Intn(count)
 	}
 
-	query := `
-		query FindScenes($filter: FindFilterType) {
-			findScenes(filter: $filter) {
-				scenes {
-					id
-					title
-					performers{
-						id
-						name
-					}
-					paths {
-						screenshot
-						stream
-						preview
-						sprite
-					}
-					studio {
-						id
-						name
-					}
-				}
-			}
-		}`
-
-	variables := map[string]interface{}{
-		"filter": map[string]interface{}{
-			"page":     randomIndex/1 + 1,
-			"per_page": 1,
-		},
-	}
-
-	resp, err := s.graphQLRequest(query, variables)
+	result, err := s.FindScenes(ctx, FindFilter{Page: randomIndex + 1, PerPage: 1}, sceneFilter)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Data.FindScenes.Scenes) == 0 {
+	if len(result.Scenes) == 0 {
 		return nil, fmt.Errorf("видео не найдено")
 	}
 
-	s.logger.Success("Найдена сцена: %s", resp.Data.FindScenes.Scenes[0].Title)
-	return &resp.Data.FindScenes.Scenes[0], nil
+	s.logger.Success("Найдена сцена: %s", result.Scenes[0].Title)
+	return &result.Scenes[0], nil
 }
 
-// TestConnection проверяет подключение к StashApp
-func (s *StashClient) TestConnection() error {
-	testQuery := `query { systemStatus { databaseSchema }}`
-	_, err := s.graphQLRequest(testQuery, nil)
+// TestConnection проверяет подключение к StashApp. Проверка выполняется
+// даже при разомкнутом автомате, а ее успех снова открывает путь запросам.
+func (s *StashClient) TestConnection(ctx context.Context) error {
+	_, err := s.request(ctx, systemStatusQuery, nil)
+	s.breaker.Record(err)
 	return err
 }
+
+// Probe проверяет связь со StashApp одной попыткой, без повторов: для проверок
+// состояния важен быстрый ответ, а не успех запроса любой ценой
+func (s *StashClient) Probe(ctx context.Context) error {
+	jsonBody, err := json.Marshal(GraphQLRequest{Query: systemStatusQuery})
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга запроса: %v", err)
+	}
+
+	_, err = s.doGraphQL(ctx, jsonBody)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	s.breaker.Record(err)
+	return err
+}
+
+// Offline сообщает, приостановлены ли запросы к Stash из-за его недоступности
+func (s *StashClient) Offline() bool {
+	return s.breaker.Open()
+}
+
+// WatchAvailability периодически проверяет связь со Stash, пока запросы приостановлены
+func (s *StashClient) WatchAvailability(ctx context.Context) {
+	if s.breaker.threshold <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !s.breaker.tryProbe() {
+			continue
+		}
+
+		s.logger.Info("Проверка связи со StashApp...")
+		probeCtx, cancel := context.WithTimeout(ctx, breakerProbeTimeout)
+		err := s.TestConnection(probeCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			// Проверка не уложилась в breakerProbeTimeout: для автомата это отказ Stash,
+			// а не прерванный вызывающим запрос
+			if callerAborted(err) {
+				s.breaker.Record(networkError(err))
+			}
+			s.logger.Warning("StashApp по-прежнему недоступен: %v", err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+// sceneFragment общий набор полей сцены для всех запросов
+const sceneFragment = `
+	fragment SceneData on Scene {
+		id
+		title
+		date
+		details
+		rating100
+		o_counter
+		play_count
+		files {
+			path
+			duration
+			width
+			height
+			size
+			video_codec
+			fingerprints {
+				type
+				value
+			}
+		}
+		paths {
+			screenshot
+			stream
+			preview
+			sprite
+		}
+		tags {
+			id
+			name
+		}
+		scene_markers {
+			id
+		}
+		performers {
+			id
+			name
+		}
+		studio {
+			id
+			name
+		}
+	}`
+
+// sceneListFragment поля сцены для строки списка: название (или имя файла), дата и длительность
+const sceneListFragment = `
+	fragment SceneListData on Scene {
+		id
+		title
+		date
+		files {
+			path
+			duration
+		}
+	}`
+
+// sceneMarkerFragment общий набор полей маркера сцены
+const sceneMarkerFragment = `
+	fragment SceneMarkerData on SceneMarker {
+		id
+		title
+		seconds
+		preview
+		stream
+		screenshot
+		primary_tag {
+			id
+			name
+		}
+		scene {
+			id
+			title
+			files {
+				path
+				width
+				height
+			}
+		}
+	}`
+
+const findScenesQuery = `
+	query FindScenes($filter: FindFilterType, $sceneFilter: SceneFilterType) {
+		findScenes(filter: $filter, scene_filter: $sceneFilter) {
+			count
+			scenes {
+				...SceneData
+			}
+		}
+	}` + sceneFragment
+
+const findSceneListQuery = `
+	query FindSceneList($filter: FindFilterType, $sceneFilter: SceneFilterType) {
+		findScenes(filter: $filter, scene_filter: $sceneFilter) {
+			count
+			scenes {
+				...SceneListData
+			}
+		}
+	}` + sceneListFragment
+
+const countScenesQuery = `
+	query CountScenes($sceneFilter: SceneFilterType) {
+		findScenes(scene_filter: $sceneFilter) {
+			count
+		}
+	}`
+
+const findSceneQuery = `
+	query FindScene($id: ID!) {
+		findScene(id: $id) {
+			...SceneData
+		}
+	}` + sceneFragment
+
+const sceneMarkersQuery = `
+	query SceneMarkers($id: ID!) {
+		findScene(id: $id) {
+			scene_markers {
+				...SceneMarkerData
+			}
+		}
+	}` + sceneMarkerFragment
+
+const findSceneMarkersQuery = `
+	query FindSceneMarkers($filter: FindFilterType, $markerFilter: SceneMarkerFilterType) {
+		findSceneMarkers(filter: $filter, scene_marker_filter: $markerFilter) {
+			count
+			scene_markers {
+				...SceneMarkerData
+			}
+		}
+	}` + sceneMarkerFragment
+
+const findMarkerTagsQuery = `
+	query FindMarkerTags($filter: FindFilterType) {
+		findTags(
+			filter: $filter
+			tag_filter: { marker_count: { value: 0, modifier: GREATER_THAN } }
+		) {
+			count
+			tags {
+				id
+				name
+				scene_marker_count
+			}
+		}
+	}`
+
+const findPerformerQuery = `
+	query FindPerformer($id: ID!) {
+		findPerformer(id: $id) {
+			id
+			name
+		}
+	}`
+
+const findStudioQuery = `
+	query FindStudio($id: ID!) {
+		findStudio(id: $id) {
+			id
+			name
+		}
+	}`
+
+const findTagQuery = `
+	query FindTag($id: ID!) {
+		findTag(id: $id) {
+			id
+			name
+		}
+	}`
+
+const findTagsQuery = `
+	query FindTags($filter: FindFilterType) {
+		findTags(filter: $filter) {
+			count
+			tags {
+				id
+				name
+			}
+		}
+	}`
+
+const sceneUpdateMutation = `
+	mutation SceneUpdate($input: SceneUpdateInput!) {
+		sceneUpdate(input: $input) {
+			...SceneData
+		}
+	}` + sceneFragment
+
+const bulkSceneUpdateMutation = `
+	mutation BulkSceneUpdate($input: BulkSceneUpdateInput!) {
+		bulkSceneUpdate(input: $input) {
+			...SceneData
+		}
+	}` + sceneFragment
+
+const sceneIncrementOMutation = `
+	mutation SceneIncrementO($id: ID!) {
+		sceneIncrementO(id: $id)
+	}`
+
+const sceneDecrementOMutation = `
+	mutation SceneDecrementO($id: ID!) {
+		sceneDecrementO(id: $id)
+	}`
+
+const sceneAddPlayMutation = `
+	mutation SceneAddPlay($id: ID!) {
+		sceneAddPlay(id: $id) {
+			count
+		}
+	}`
+
+const sceneDeletePlayMutation = `
+	mutation SceneDeletePlay($id: ID!) {
+		sceneDeletePlay(id: $id) {
+			count
+		}
+	}`
+
+const systemStatusQuery = `query SystemStatus { systemStatus { databaseSchema }}`
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// StreamSigner выдает подписанные ссылки на стрим с ограниченным сроком действия,
+// чтобы в чаты не попадали адрес Stash и ключ API
+type StreamSigner struct {
+	baseURL string
+	secret  []byte
+	ttl     time.Duration
+}
+
+func NewStreamSigner(baseURL, secret string, ttl time.Duration) *StreamSigner {
+	key := []byte(secret)
+	if len(key) == 0 {
+		// Без постоянного секрета ссылки перестанут работать после перезапуска
+		key = make([]byte, 32)
+		crand.Read(key)
+	}
+
+	return &StreamSigner{
+		baseURL: baseURL,
+		secret:  key,
+		ttl:     ttl,
+	}
+}
+
+// SignedURL возвращает ссылку на ресурс (/stream/<путь>), подписанную для пользователя
+// Telegram, с ограниченным сроком действия
+func (s *StreamSigner) SignedURL(path string, userID int64) string {
+	exp := time.Now().Add(s.ttl).Unix()
+
+	query := url.Values{}
+	query.Set("uid", strconv.FormatInt(userID, 10))
+	query.Set("exp", strconv.FormatInt(exp, 10))
+	query.Set("sig", s.signature(path, userID, exp))
+
+	return fmt.Sprintf("%s/stream/%s?%s", s.baseURL, path, query.Encode())
+}
+
+// Verify проверяет подпись и срок действия ссылки и возвращает пользователя, для которого она выдана
+func (s *StreamSigner) Verify(path string, query url.Values) (int64, error) {
+	userID, err := strconv.ParseInt(query.Get("uid"), 10, 64)
+	if err != nil {
+		return 0, errors.New("неверный пользователь в ссылке")
+	}
+
+	expires, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil {
+		return 0, errors.New("неверный срок действия ссылки")
+	}
+
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(s.signature(path, userID, expires))) {
+		return 0, errors.New("неверная подпись ссылки")
+	}
+
+	if time.Now().Unix() > expires {
+		return 0, errors.New("срок действия ссылки истек")
+	}
+
+	return userID, nil
+}
+
+// signature вычисляет HMAC-SHA256 пути, пользователя и срока действия
+func (s *StreamSigner) signature(path string, userID, exp int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%d\n%d", path, userID, exp)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sceneStreamPath путь стрима сцены для подписанной ссылки
+func sceneStreamPath(sceneID string) string {
+	return url.PathEscape(sceneID)
+}
+
+// markerStreamPath путь стрима маркера для подписанной ссылки
+func markerStreamPath(marker *SceneMarker) string {
+	return url.PathEscape(marker.Scene.ID) + "/" + url.PathEscape(marker.ID)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamSignerVerify(t *testing.T) {
+	signer := NewStreamSigner("https://bot.example", "secret", time.Hour)
+	other := NewStreamSigner("https://bot.example", "other-secret", time.Hour)
+
+	// signed возвращает параметры ссылки, выданной signer для пути и пользователя
+	signed := func(s *StreamSigner, path string, userID int64) url.Values {
+		link, err := url.Parse(s.SignedURL(path, userID))
+		if err != nil {
+			t.Fatalf("неверная ссылка: %v", err)
+		}
+		return link.Query()
+	}
+
+	expired := signed(signer, "42", 7)
+	past := time.Now().Add(-time.Minute).Unix()
+	expired.Set("exp", strconv.FormatInt(past, 10))
+	expired.Set("sig", signer.signature("42", 7, past))
+
+	tests := []struct {
+		name    string
+		path    string
+		query   url.Values
+		wantUID int64
+		wantErr string
+	}{
+		{
+			name:    "valid link",
+			path:    "42",
+			query:   signed(signer, "42", 7),
+			wantUID: 7,
+		},
+		{
+			name:    "other path",
+			path:    "43",
+			query:   signed(signer, "42", 7),
+			wantErr: "подпись",
+		},
+		{
+			name: "other user",
+			path: "42",
+			query: func() url.Values {
+				q := signed(signer, "42", 7)
+				q.Set("uid", "8")
+				return q
+			}(),
+			wantErr: "подпись",
+		},
+		{
+			name: "extended expiry",
+			path: "42",
+			query: func() url.Values {
+				q := signed(signer, "42", 7)
+				q.Set("exp", strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10))
+				return q
+			}(),
+			wantErr: "подпись",
+		},
+		{
+			name:    "other secret",
+			path:    "42",
+			query:   signed(other, "42", 7),
+			wantErr: "подпись",
+		},
+		{
+			name:    "expired",
+			path:    "42",
+			query:   expired,
+			wantErr: "истек",
+		},
+		{
+			name:    "missing uid",
+			path:    "42",
+			query:   url.Values{"exp": {"1"}, "sig": {"x"}},
+			wantErr: "пользователь",
+		},
+		{
+			name:    "missing exp",
+			path:    "42",
+			query:   url.Values{"uid": {"7"}, "sig": {"x"}},
+			wantErr: "срок",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, err := signer.Verify(tt.path, tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if uid != tt.wantUID {
+				t.Fatalf("Verify() uid = %d, want %d", uid, tt.wantUID)
+			}
+		})
+	}
+}
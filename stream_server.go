@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Заголовки, которые передаются между зрителем и Stash
+var (
+	streamRequestHeaders  = []string{"Range", "If-Range", "If-Modified-Since", "If-None-Match"}
+	streamResponseHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag", "Cache-Control"}
+)
+
+// StreamServer встроенный HTTP сервер, проксирующий подписанные ссылки на стрим в Stash
+type StreamServer struct {
+	stashURL string
+	apiKey   string
+	signer   *StreamSigner
+	access   *AccessControl
+	client   *http.Client
+	logger   *Logger
+}
+
+func NewStreamServer(config Config, signer *StreamSigner, access *AccessControl) *StreamServer {
+	return &StreamServer{
+		stashURL: config.StashURL,
+		apiKey:   config.StashAPIKey,
+		signer:   signer,
+		access:   access,
+		// Без общего таймаута: просмотр видео может длиться часами
+		client: &http.Client{
+			Transport: &http.Transport{
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 30 * time.Second,
+			},
+		},
+		logger: NewLogger("StreamServer"),
+	}
+}
+
+// Run запускает сервер и останавливает его при отмене контекста
+func (s *StreamServer) Run(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream/", s.handleStream)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	s.logger.Info("Сервер стрима слушает %s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("ошибка сервера стрима: %w", err)
+	}
+	return nil
+}
+
+// handleStream проверяет подпись ссылки и передает стрим из Stash (/stream/<сцена>[/<маркер>])
+func (s *StreamServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/stream/")
+	userID, err := s.signer.Verify(path, r.URL.Query())
+	if err != nil {
+		s.logger.Warning("Отклонен запрос стрима %s: %v", path, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Ссылка действует, только пока у пользователя, для которого она подписана, есть доступ
+	if s.access.RoleFor(userID, userID) == RoleGuest {
+		s.logger.With("user_id", userID, "stream", path).Warning("Отклонен запрос стрима: у пользователя нет доступа")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	upstream, err := s.upstreamURL(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, upstream, nil)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	for _, name := range streamRequestHeaders {
+		if value := r.Header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	if s.apiKey != "" {
+		req.Header.Set("ApiKey", s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Error("Ошибка запроса стрима %s: %v", path, err)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if r.Header.Get("Range") == "" {
+		s.logger.With("user_id", userID, "stream", path).Info("Начат просмотр стрима")
+	}
+
+	for _, name := range streamResponseHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	if r.Method == http.MethodGet {
+		// Обрыв соединения зрителем - обычное дело при перемотке
+		io.Copy(w, resp.Body)
+	}
+}
+
+// upstreamURL возвращает адрес стрима в Stash для пути подписанной ссылки
+func (s *StreamServer) upstreamURL(path string) (string, error) {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		value, err := url.PathUnescape(part)
+		if err != nil || value == "" {
+			return "", errors.New("неверный путь стрима")
+		}
+		parts[i] = url.PathEscape(value)
+	}
+
+	switch len(parts) {
+	case 1:
+		return fmt.Sprintf("%s/scene/%s/stream", s.stashURL, parts[0]), nil
+	case 2:
+		return fmt.Sprintf("%s/scene/%s/scene_marker/%s/stream", s.stashURL, parts[0], parts[1]), nil
+	default:
+		return "", errors.New("неверный путь стрима")
+	}
+}
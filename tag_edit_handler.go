@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// tagPickerSize количество тегов в результатах поиска
+const tagPickerSize = 10
+
+// tagEditTTL через сколько после последнего действия заброшенный редактор тегов закрывается
+const tagEditTTL = 30 * time.Minute
+
+const (
+	tagEditBusyText   = "✋ Теги этой сцены сейчас редактирует другой пользователь"
+	tagEditClosedText = "⌛ Редактор тегов закрыт, откройте его снова"
+)
+
+// tagEditKey сообщение сцены, в котором открыт редактор тегов
+type tagEditKey struct {
+	chatID    int64
+	messageID int
+}
+
+// tagEditSession незавершенное редактирование тегов сцены. Закрыть его может
+// только открывший редактор пользователь (userID).
+type tagEditSession struct {
+	sceneID  string
+	userID   int64
+	sceneMsg *models.Message
+	page     int
+	awaiting bool
+	touched  time.Time
+}
+
+// handleTagEditCallback открывает редактор тегов сцены или его страницу (tagedit_<id>[_<страница>])
+func (h *BotHandler) handleTagEditCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	msg := callback.Message.Message
+	sceneID, value, _ := strings.Cut(strings.TrimPrefix(callback.Data, "tagedit_"), "_")
+	page, err := strconv.Atoi(value)
+	if err != nil {
+		page = 1
+	}
+
+	// Сообщение недоступно (слишком старое) - редактировать нечего
+	if msg == nil {
+		h.answerCallback(ctx, b, callback, "❌ Сообщение со сценой недоступно, откройте сцену заново", true)
+		return
+	}
+
+	scene, err := h.stash.FindScene(ctx, sceneID)
+	if err != nil {
+		h.logger.Error("Ошибка получения сцены %s: %v", sceneID, err)
+		h.answerStashError(ctx, b, callback, "❌ Не удалось открыть редактор тегов: ", err)
+		return
+	}
+
+	key := tagEditKey{chatID: msg.Chat.ID, messageID: msg.ID}
+	userID := callback.From.ID
+
+	h.lockTagEdits()
+	if session, ok := h.tagEdits[key]; ok && session.userID != userID {
+		h.tagEditMu.Unlock()
+		h.answerCallback(ctx, b, callback, tagEditBusyText, true)
+		return
+	}
+	// Пользователь ведет один редактор в чате: ожидаемый запрос тега относится к нему
+	for k, session := range h.tagEdits {
+		if k != key && k.chatID == key.chatID && session.userID == userID {
+			delete(h.tagEdits, k)
+		}
+	}
+	h.tagEdits[key] = &tagEditSession{
+		sceneID:  sceneID,
+		userID:   userID,
+		sceneMsg: msg,
+		page:     page,
+		touched:  time.Now(),
+	}
+	h.tagEditMu.Unlock()
+
+	h.answerCallback(ctx, b, callback, "", false)
+
+	b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.ID,
+		ReplyMarkup: CreateTagEditorKeyboard(scene, page),
+	})
+}
+
+// handleTagRemoveCallback удаляет тег у сцены (tagrm_<id сцены>_<id тега>)
+func (h *BotHandler) handleTagRemoveCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	msg := callback.Message.Message
+	sceneID, tagID, ok := strings.Cut(strings.TrimPrefix(callback.Data, "tagrm_"), "_")
+	if !ok {
+		h.answerCallback(ctx, b, callback, "", false)
+		return
+	}
+
+	if msg == nil {
+		h.answerCallback(ctx, b, callback, "❌ Сообщение со сценой недоступно, откройте сцену заново", true)
+		return
+	}
+
+	// Удалять теги может только тот, кто открыл редактор
+	h.lockTagEdits()
+	session := h.ownTagEditLocked(msg.Chat.ID, callback.From.ID, sceneID)
+	_, busy := h.tagEdits[tagEditKey{chatID: msg.Chat.ID, messageID: msg.ID}]
+	h.tagEditMu.Unlock()
+
+	if session == nil {
+		text := tagEditClosedText
+		if busy {
+			text = tagEditBusyText
+		}
+		h.answerCallback(ctx, b, callback, text, true)
+		return
+	}
+
+	scene, err := h.stash.UpdateSceneTags(ctx, sceneID, BulkUpdateRemove, tagID)
+	if err != nil {
+		h.logger.Error("Ошибка удаления тега %s у сцены %s: %v", tagID, sceneID, err)
+		h.answerStashError(ctx, b, callback, "❌ Не удалось удалить тег: ", err)
+		return
+	}
+
+	h.answerCallback(ctx, b, callback, "🗑 Тег удален", false)
+	h.refreshSceneMessage(ctx, b, msg, scene, CreateTagEditorKeyboard(scene, h.tagEditPage(msg)))
+}
+
+// handleTagSearchCallback просит прислать название тега для поиска (tagsearch_<id>)
+func (h *BotHandler) handleTagSearchCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	msg := callback.Message.Message
+	sceneID := strings.TrimPrefix(callback.Data, "tagsearch_")
+
+	if msg == nil {
+		h.answerCallback(ctx, b, callback, "❌ Сообщение со сценой недоступно, откройте сцену заново", true)
+		return
+	}
+	chatID := msg.Chat.ID
+
+	h.lockTagEdits()
+	session := h.ownTagEditLocked(chatID, callback.From.ID, sceneID)
+	if session != nil {
+		session.awaiting = true
+	}
+	h.tagEditMu.Unlock()
+
+	if session == nil {
+		h.answerCallback(ctx, b, callback, tagEditClosedText, true)
+		return
+	}
+
+	h.answerCallback(ctx, b, callback, "", false)
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "🔍 Отправьте часть названия тега",
+	})
+}
+
+// handleTagSearchQuery ищет теги по тексту, если в чате ожидается запрос для редактора тегов.
+// Возвращает true, если сообщение обработано.
+func (h *BotHandler) handleTagSearchQuery(ctx context.Context, b *bot.Bot, msg *models.Message) bool {
+	if msg.From == nil {
+		return false
+	}
+
+	h.lockTagEdits()
+	var session *tagEditSession
+	for key, s := range h.tagEdits {
+		if key.chatID == msg.Chat.ID && s.userID == msg.From.ID && s.awaiting {
+			session = s
+			session.touched = time.Now()
+			break
+		}
+	}
+	if session == nil {
+		h.tagEditMu.Unlock()
+		return false
+	}
+	session.awaiting = false
+	sceneID := session.sceneID
+	h.tagEditMu.Unlock()
+
+	q := strings.TrimSpace(msg.Text)
+	result, err := h.stash.FindTags(ctx, FindFilter{Q: q, PerPage: tagPickerSize, Sort: "name"})
+	if err != nil {
+		h.logger.Error("Ошибка поиска тегов: %v", err)
+		h.replyStashError(ctx, b, msg.Chat.ID, "❌ Ошибка поиска: ", err)
+		return true
+	}
+
+	text := fmt.Sprintf("🏷 Теги по запросу <b>%s</b>: %d", escapeHTML(q), result.Count)
+	if result.Count == 0 {
+		text = fmt.Sprintf("🏷 Теги по запросу <b>%s</b> не найдены", escapeHTML(q))
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      msg.Chat.ID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: CreateTagPickerKeyboard(sceneID, result.Tags),
+	})
+	return true
+}
+
+// handleTagPutCallback добавляет тег сцене (tagput_<id сцены>_<id тега>)
+func (h *BotHandler) handleTagPutCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	msg := callback.Message.Message
+	sceneID, tagID, ok := strings.Cut(strings.TrimPrefix(callback.Data, "tagput_"), "_")
+	if !ok {
+		h.answerCallback(ctx, b, callback, "", false)
+		return
+	}
+
+	// Без сообщения неизвестен чат, в котором открыт редактор
+	if msg == nil {
+		h.answerCallback(ctx, b, callback, "❌ Сообщение с тегами недоступно, найдите тег заново", true)
+		return
+	}
+
+	scene, err := h.stash.UpdateSceneTags(ctx, sceneID, BulkUpdateAdd, tagID)
+	if err != nil {
+		h.logger.Error("Ошибка добавления тега %s сцене %s: %v", tagID, sceneID, err)
+		h.answerStashError(ctx, b, callback, "❌ Не удалось добавить тег: ", err)
+		return
+	}
+
+	h.answerCallback(ctx, b, callback, "✅ Тег добавлен", false)
+
+	// Обновляем исходное сообщение сцены, если редактор еще открыт
+	h.lockTagEdits()
+	session := h.ownTagEditLocked(msg.Chat.ID, callback.From.ID, sceneID)
+	h.tagEditMu.Unlock()
+
+	if session != nil {
+		h.refreshSceneMessage(ctx, b, session.sceneMsg, scene, CreateTagEditorKeyboard(scene, h.tagEditPage(session.sceneMsg)))
+	}
+}
+
+// handleTagDoneCallback закрывает редактор тегов и возвращает основную клавиатуру сцены (tagdone_<id>)
+func (h *BotHandler) handleTagDoneCallback(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery) {
+	msg := callback.Message.Message
+	if msg == nil {
+		h.answerCallback(ctx, b, callback, "❌ Сообщение со сценой недоступно, откройте сцену заново", true)
+		return
+	}
+
+	// Сессии может не быть (бот перезапускался) - тогда просто возвращаем клавиатуру
+	key := tagEditKey{chatID: msg.Chat.ID, messageID: msg.ID}
+	h.lockTagEdits()
+	if session, ok := h.tagEdits[key]; ok {
+		if session.userID != callback.From.ID {
+			h.tagEditMu.Unlock()
+			h.answerCallback(ctx, b, callback, tagEditBusyText, true)
+			return
+		}
+		delete(h.tagEdits, key)
+	}
+	h.tagEditMu.Unlock()
+
+	h.answerCallback(ctx, b, callback, "", false)
+	h.editSceneKeyboard(ctx, b, callback, strings.TrimPrefix(callback.Data, "tagdone_"), func(scene *Scene) *models.InlineKeyboardMarkup {
+		return h.sceneKeyboard(ctx, scene)
+	})
+}
+
+// lockTagEdits захватывает h.tagEditMu и закрывает редакторы, к которым не
+// обращались дольше tagEditTTL: их владельцы ушли, не нажав "Готово"
+func (h *BotHandler) lockTagEdits() {
+	h.tagEditMu.Lock()
+
+	now := time.Now()
+	for key, session := range h.tagEdits {
+		if now.Sub(session.touched) >= tagEditTTL {
+			delete(h.tagEdits, key)
+		}
+	}
+}
+
+// ownTagEditLocked возвращает открытый пользователем в чате редактор тегов сцены
+// и продлевает его; вызывается под h.tagEditMu
+func (h *BotHandler) ownTagEditLocked(chatID, userID int64, sceneID string) *tagEditSession {
+	for key, session := range h.tagEdits {
+		if key.chatID == chatID && session.userID == userID && session.sceneID == sceneID {
+			session.touched = time.Now()
+			return session
+		}
+	}
+	return nil
+}
+
+// tagEditPage возвращает открытую страницу редактора тегов в сообщении сцены
+func (h *BotHandler) tagEditPage(msg *models.Message) int {
+	if msg == nil {
+		return 1
+	}
+
+	h.lockTagEdits()
+	defer h.tagEditMu.Unlock()
+
+	if session, ok := h.tagEdits[tagEditKey{chatID: msg.Chat.ID, messageID: msg.ID}]; ok {
+		return session.page
+	}
+	return 1
+}
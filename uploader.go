@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// uploadFile файл для потоковой загрузки в Telegram
+type uploadFile struct {
+	field    string
+	filename string
+	data     io.Reader
+}
+
+// TelegramUploader отправляет файлы в Telegram потоком, не собирая запрос в памяти.
+// Библиотека бота формирует multipart целиком в буфере, поэтому для больших превью
+// используется собственная загрузка через io.Pipe.
+type TelegramUploader struct {
+	apiURL  string
+	token   string
+	timeout time.Duration
+	client  *http.Client
+	logger  *Logger
+}
+
+func NewTelegramUploader(config *Config) *TelegramUploader {
+	return &TelegramUploader{
+		apiURL:  config.TelegramAPIURL,
+		token:   config.TelegramToken,
+		timeout: config.TelegramUploadTimeout,
+		client:  &http.Client{Transport: newTelegramTransport()},
+		logger:  NewLogger("Uploader"),
+	}
+}
+
+// Upload вызывает метод Bot API с полями формы и файлами, передавая файлы потоком
+func (u *TelegramUploader) Upload(ctx context.Context, method string, fields map[string]string, files ...uploadFile) (*models.Message, error) {
+	// Зависшая загрузка не должна держать обработчик бесконечно
+	ctx, cancel := context.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	// Файлы закрывает вызывающий после возврата, поэтому дожидаемся записи формы.
+	// Закрытие pr прерывает запись, если Telegram ответил, не дочитав запрос.
+	done := make(chan struct{})
+	defer func() { <-done }()
+	defer pr.Close()
+
+	go func() {
+		defer close(done)
+		pw.CloseWithError(writeUploadForm(form, fields, files))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/bot%s/%s", u.apiURL, u.token, method), pr)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", u.redact(err))
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса %s: %w", method, u.redact(err))
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool            `json:"ok"`
+		Result      *models.Message `json:"result"`
+		Description string          `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга ответа %s: %w", method, err)
+	}
+
+	if !result.OK {
+		return nil, fmt.Errorf("%s: %s", method, result.Description)
+	}
+
+	return result.Result, nil
+}
+
+// redact убирает токен бота из адреса в ошибке HTTP клиента, чтобы он не попал в логи
+func (u *TelegramUploader) redact(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = strings.ReplaceAll(urlErr.URL, u.token, "<token>")
+	}
+	return err
+}
+
+// writeUploadForm записывает поля и файлы формы в поток
+func writeUploadForm(form *multipart.Writer, fields map[string]string, files []uploadFile) error {
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		part, err := form.CreateFormFile(f.field, f.filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, f.data); err != nil {
+			return err
+		}
+	}
+
+	return form.Close()
+}
+
+// replyMarkupField сериализует клавиатуру для поля reply_markup
+func replyMarkupField(kb models.ReplyMarkup) string {
+	data, err := json.Marshal(kb)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -1,6 +1,9 @@
 package main
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 // escapeHTML экранирует HTML символы
 func escapeHTML(text string) string {
@@ -14,10 +17,30 @@ func escapeHTML(text string) string {
 	return replacer.Replace(text)
 }
 
-// truncateString обрезает строку до заданной длины
+// truncateString обрезает строку до заданной длины (в символах)
 func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
+	runes := []rune(s)
+	if len(runes) <= maxLen {
 		return s
 	}
-	return s[:maxLen-3] + "..."
+	return string(runes[:maxLen-3]) + "..."
+}
+
+// formatDuration форматирует длительность в секундах как ч:мм:сс или м:сс
+func formatDuration(seconds float64) string {
+	total := int(seconds)
+	h, m, sec := total/3600, total%3600/60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return fmt.Sprintf("%d:%02d", m, sec)
+}
+
+// formatSize форматирует размер файла в байтах
+func formatSize(size int64) string {
+	const mb = 1024 * 1024
+	if size >= 1024*mb {
+		return fmt.Sprintf("%.2f GB", float64(size)/1024/mb)
+	}
+	return fmt.Sprintf("%.1f MB", float64(size)/mb)
 }
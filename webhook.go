@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// webhookSecretHeader заголовок, в котором Telegram передает секрет вебхука
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// WebhookServer принимает обновления от Telegram по HTTP(S) вместо long polling
+type WebhookServer struct {
+	config Config
+	logger *Logger
+}
+
+func NewWebhookServer(config Config) *WebhookServer {
+	return &WebhookServer{
+		config: config,
+		logger: NewLogger("Webhook"),
+	}
+}
+
+// Register сообщает Telegram адрес вебхука
+func (w *WebhookServer) Register(ctx context.Context, b *bot.Bot) error {
+	params := &bot.SetWebhookParams{
+		URL:         w.config.WebhookURL,
+		SecretToken: w.config.WebhookSecret,
+	}
+
+	// Самоподписанный сертификат нужно передать Telegram, иначе он не доверит адресу.
+	// Сертификату доверенного центра Telegram доверяет и так.
+	if w.config.WebhookSelfSigned {
+		cert, err := os.Open(w.config.WebhookCertFile)
+		if err != nil {
+			return fmt.Errorf("не удалось открыть сертификат: %w", err)
+		}
+		defer cert.Close()
+
+		params.Certificate = &models.InputFileUpload{
+			Filename: filepath.Base(w.config.WebhookCertFile),
+			Data:     cert,
+		}
+	}
+
+	if _, err := b.SetWebhook(ctx, params); err != nil {
+		return fmt.Errorf("не удалось установить вебхук: %w", err)
+	}
+
+	w.logger.Success("Вебхук установлен: %s", w.config.WebhookURL)
+	return nil
+}
+
+// Run запускает HTTP сервер вебхука и останавливает его при отмене контекста
+func (w *WebhookServer) Run(ctx context.Context, b *bot.Bot) error {
+	path := "/"
+	if u, err := url.Parse(w.config.WebhookURL); err == nil && u.Path != "" {
+		path = u.Path
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, w.verify(b.WebhookHandler()))
+
+	server := &http.Server{
+		Addr:              w.config.WebhookListen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	w.logger.Info("Вебхук слушает %s%s", w.config.WebhookListen, path)
+
+	var err error
+	if w.config.WebhookCertFile != "" {
+		err = server.ListenAndServeTLS(w.config.WebhookCertFile, w.config.WebhookKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("ошибка сервера вебхука: %w", err)
+	}
+	return nil
+}
+
+// verify отклоняет запросы без верного секрета, не передавая их боту
+func (w *WebhookServer) verify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		secret := r.Header.Get(webhookSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(w.config.WebhookSecret)) != 1 {
+			w.logger.Warning("Отклонен запрос вебхука с %s: неверный секрет", r.RemoteAddr)
+			http.Error(rw, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}